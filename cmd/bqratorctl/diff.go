@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nais/bqrator/controllers"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func runDiff(ctx context.Context, args []string, e env) (int, error) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: bqratorctl diff [flags] FILE...\n\nReads BigQueryDataset manifests from the files, or stdin for -, and shows the\nchanges bqrator would make to the datasets in BigQuery.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	project := fs.String("project", "", "GCP project of the datasets. Resolved in the cluster of the current kubeconfig context if empty, like bqrator does.")
+	namespace := fs.String("namespace", "", "Namespace of manifests that don't set one.")
+	ownerEmail := fs.String("owner-email", "", "Email of the service account bqrator runs as, which is added as owner. Defaults to ownerEmail of --config.")
+	configPath := fs.String("config", "", configUsage)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, nil
+		}
+		return exitError, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError, errors.New("no files given")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return exitError, err
+	}
+	if *ownerEmail == "" {
+		*ownerEmail = cfg.OwnerEmail
+	}
+
+	var datasets []google_nais_io_v1.BigQueryDataset
+	for _, path := range fs.Args() {
+		read, err := readManifests(path, e.stdin)
+		if err != nil {
+			return exitError, err
+		}
+		datasets = append(datasets, read...)
+	}
+
+	var resolver controllers.ProjectResolver
+	if *project == "" {
+		c, err := e.kubeClient()
+		if err != nil {
+			return exitError, fmt.Errorf("creating kubernetes client to resolve projects: %w", err)
+		}
+		resolver = &controllers.RecordedProjectResolver{
+			Reader:   c,
+			Resolver: controllers.NewProjectResolver(c, cfg.Project),
+		}
+	}
+
+	bq, err := e.bigQuery(ctx)
+	if err != nil {
+		return exitError, err
+	}
+
+	code := exitOK
+	for _, dataset := range datasets {
+		if dataset.Namespace == "" {
+			dataset.Namespace = *namespace
+		}
+		if dataset.Namespace == "" {
+			return exitError, fmt.Errorf("BigQueryDataset %s has no namespace, use --namespace", dataset.Name)
+		}
+
+		projectID := *project
+		if projectID == "" {
+			projectID, err = resolver.ResolveProject(ctx, dataset)
+			if err != nil {
+				return exitError, fmt.Errorf("resolving project of %s/%s: %w", dataset.Namespace, dataset.Name, err)
+			}
+		}
+
+		plan, err := controllers.PlanDataset(ctx, bq, dataset, projectID, *ownerEmail)
+		if err != nil {
+			return exitError, fmt.Errorf("planning %s/%s: %w", dataset.Namespace, dataset.Name, err)
+		}
+		printPlan(e.stdout, dataset, plan)
+		if plan.Action != controllers.PlanNone {
+			code = exitChanges
+		}
+	}
+	return code, nil
+}
+
+func printPlan(w io.Writer, dataset google_nais_io_v1.BigQueryDataset, plan controllers.Plan) {
+	fmt.Fprintf(w, "BigQueryDataset %s/%s, dataset %s.%s: %s\n", dataset.Namespace, dataset.Name, plan.ProjectID, plan.Name, plan.Action)
+	for _, change := range plan.Changes {
+		fmt.Fprintf(w, "  %s\n", change)
+	}
+}
+
+// readManifests returns the BigQueryDatasets in the YAML or JSON documents in
+// the file at path, or in stdin if path is "-". Other kinds are skipped.
+func readManifests(path string, stdin io.Reader) ([]google_nais_io_v1.BigQueryDataset, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var datasets []google_nais_io_v1.BigQueryDataset
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var dataset google_nais_io_v1.BigQueryDataset
+		if err := decoder.Decode(&dataset); errors.Is(err, io.EOF) {
+			return datasets, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if dataset.Kind == "BigQueryDataset" {
+			datasets = append(datasets, dataset)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/nais/bqrator/controllers"
+	"github.com/nais/bqrator/pkg/fakebigquery"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const manifests = `apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  name: existing
+  namespace: team
+spec:
+  name: existing
+  location: europe-north1
+  description: new description
+  access:
+    - role: READER
+      userByEmail: reader@example.com
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  name: missing
+spec:
+  name: missing
+  location: europe-north1
+  access:
+    - role: WRITER
+      userByEmail: writer@example.com
+`
+
+// newTestEnv returns an env using a fake BigQuery server, with a dataset
+// named existing in project proj, and a fake cluster with namespace team
+// belonging to proj.
+func newTestEnv(t *testing.T) (env, *bytes.Buffer) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakebigquery.New())
+	t.Cleanup(srv.Close)
+	bqClient, err := bigquery.NewClient(ctx, "proj", option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bqClient.Close() })
+	bq := &controllers.BigQueryWrapper{Client: bqClient}
+
+	err = bq.Create(ctx, "proj", &bigquery.DatasetMetadata{
+		Name:        "existing",
+		Location:    "europe-north1",
+		Description: "old description",
+		Labels:      map[string]string{"team": "team"},
+		Access: []*bigquery.AccessEntry{
+			{Role: bigquery.OwnerRole, EntityType: bigquery.UserEmailEntity, Entity: "bqrator@example.com"},
+			{Role: bigquery.WriterRole, EntityType: bigquery.UserEmailEntity, Entity: "reader@example.com"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.GroupEmailEntity, Entity: "manual@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kube := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"google-cloud-project": "proj"}},
+	}).Build()
+
+	stdout := &bytes.Buffer{}
+	return env{
+		stdin:      strings.NewReader(manifests),
+		stdout:     stdout,
+		stderr:     &bytes.Buffer{},
+		bigQuery:   func(context.Context) (controllers.BigQuery, error) { return bq, nil },
+		kubeClient: func() (client.Reader, error) { return kube, nil },
+	}, stdout
+}
+
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestDiff(t *testing.T) {
+	want := `BigQueryDataset team/existing, dataset proj.existing: update
+  description "old description" -> "new description"
+  add READER user:reader@example.com
+  remove WRITER user:reader@example.com
+  keep OWNER user:bqrator@example.com
+  keep READER group:manual@example.com
+BigQueryDataset team/missing, dataset proj.missing: create
+  name "" -> "missing"
+  label team "" -> "team"
+  add WRITER user:writer@example.com
+  add OWNER user:bqrator@example.com
+`
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "project from flag",
+			args: []string{"diff", "--project", "proj", "--namespace", "team", "--owner-email", "bqrator@example.com", "-"},
+		},
+		{
+			name: "project from namespace",
+			args: []string{"diff", "--namespace", "team", "--owner-email", "bqrator@example.com", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, stdout := newTestEnv(t)
+			if code := run(context.Background(), tt.args, e); code != exitChanges {
+				t.Errorf("run() = %d, want %d, stderr: %s", code, exitChanges, e.stderr)
+			}
+			if diff := cmp.Diff(want, stdout.String()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	e, stdout := newTestEnv(t)
+	path := filepath.Join(t.TempDir(), "dataset.yaml")
+	manifest := `apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  name: existing
+  namespace: team
+spec:
+  name: existing
+  location: europe-north1
+  description: old description
+  access:
+    - role: WRITER
+      userByEmail: reader@example.com
+`
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run(context.Background(), []string{"diff", "--project", "proj", "--owner-email", "bqrator@example.com", path}, e); code != exitOK {
+		t.Errorf("run() = %d, want %d, stderr: %s", code, exitOK, e.stderr)
+	}
+	if !strings.HasPrefix(stdout.String(), "BigQueryDataset team/existing, dataset proj.existing: none\n") {
+		t.Errorf("unexpected output:\n%s", stdout)
+	}
+}
+
+func TestDiffProjectResolution(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	manifest := `apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  name: existing
+  namespace: team
+%s
+spec:
+  name: existing
+  location: europe-north1
+`
+	plain := writeFile("plain.yaml", fmt.Sprintf(manifest, ""))
+	annotated := writeFile("annotated.yaml", fmt.Sprintf(manifest, "  annotations:\n    bqrator.nais.io/project-id: proj"))
+	labelConfig := writeFile("label.yaml", "project:\n  labelKeys: [team-project]\n")
+	mapConfig := writeFile("map.yaml", "project:\n  mapConfigMap: bqrator/projects\n")
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "team",
+		Labels: map[string]string{"google-cloud-project": "wrong", "team-project": "proj"},
+	}}
+	projectMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "bqrator", Name: "projects"},
+		Data:       map[string]string{"team": "proj"},
+	}
+	recorded := &naisv1.BigQueryDataset{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "team",
+		Name:        "existing",
+		Annotations: map[string]string{"bqrator.nais.io/project-id": "proj"},
+	}}
+
+	tests := []struct {
+		name    string
+		args    []string
+		objects []client.Object
+	}{
+		{name: "annotation in manifest", args: []string{annotated}},
+		{name: "annotation in cluster", args: []string{plain}, objects: []client.Object{recorded}},
+		{name: "label keys from config", args: []string{"--config", labelConfig, plain}},
+		{name: "project map from config", args: []string{"--config", mapConfig, plain}, objects: []client.Object{projectMap}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, stdout := newTestEnv(t)
+			kube := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(append(tt.objects, namespace)...).Build()
+			e.kubeClient = func() (client.Reader, error) { return kube, nil }
+
+			args := append([]string{"diff", "--owner-email", "bqrator@example.com"}, tt.args...)
+			if code := run(context.Background(), args, e); code == exitError {
+				t.Fatalf("run() failed, stderr: %s", e.stderr)
+			}
+			if !strings.HasPrefix(stdout.String(), "BigQueryDataset team/existing, dataset proj.existing: ") {
+				t.Errorf("expected dataset to be resolved to project proj, got:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no files", args: []string{"diff", "--project", "proj"}},
+		{name: "missing file", args: []string{"diff", "--project", "proj", "missing.yaml"}},
+		{name: "no namespace", args: []string{"diff", "--project", "proj", "-"}},
+		{name: "unknown command", args: []string{"apply"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestEnv(t)
+			if code := run(context.Background(), tt.args, e); code != exitError {
+				t.Errorf("run() = %d, want %d", code, exitError)
+			}
+		})
+	}
+}
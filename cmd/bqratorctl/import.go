@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/controllers"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// manifest is a BigQueryDataset without status, the metadata fields set by the
+// API server and empty optional fields, for writing manifests.
+type manifest struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   manifestMetadata `json:"metadata"`
+	Spec       manifestSpec     `json:"spec"`
+}
+
+// manifestSpec has the fields of BigQueryDatasetSpec that import sets.
+type manifestSpec struct {
+	Name        string                            `json:"name"`
+	Location    string                            `json:"location"`
+	Description string                            `json:"description,omitempty"`
+	Access      []google_nais_io_v1.DatasetAccess `json:"access,omitempty"`
+}
+
+type manifestMetadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func runImport(ctx context.Context, args []string, e env) (int, error) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: bqratorctl import [flags] [DATASET...]\n\nWrites BigQueryDataset manifests for the given datasets, or all datasets\nmatching --filter, in the project. Anything bqrator can't represent is noted\nin a comment above each manifest.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	project := fs.String("project", "", "GCP project of the datasets. Resolved from --namespace in the cluster of the current kubeconfig context if empty, like bqrator does.")
+	filter := fs.String("filter", "", `Only import datasets matching this BigQuery list filter, such as "labels.team:myteam".`)
+	namespace := fs.String("namespace", "", "Namespace of the manifests. Defaults to the team label of each dataset.")
+	ownerEmail := fs.String("owner-email", "", "Email of the service account bqrator runs as, which is left out of the access list as bqrator adds it. Defaults to ownerEmail of --config.")
+	configPath := fs.String("config", "", configUsage)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, nil
+		}
+		return exitError, err
+	}
+	if *project == "" && *namespace == "" {
+		fs.Usage()
+		return exitError, errors.New("--project or --namespace is required")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return exitError, err
+	}
+	if *ownerEmail == "" {
+		*ownerEmail = cfg.OwnerEmail
+	}
+
+	if *project == "" {
+		c, err := e.kubeClient()
+		if err != nil {
+			return exitError, fmt.Errorf("creating kubernetes client to resolve the project: %w", err)
+		}
+		resolver := controllers.NewProjectResolver(c, cfg.Project)
+		*project, err = resolver.ResolveProject(ctx, google_nais_io_v1.BigQueryDataset{ObjectMeta: metav1.ObjectMeta{Namespace: *namespace}})
+		if err != nil {
+			return exitError, fmt.Errorf("resolving GCP project of namespace %s: %w", *namespace, err)
+		}
+	}
+
+	bq, err := e.bigQuery(ctx)
+	if err != nil {
+		return exitError, err
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names, err = bq.List(ctx, *project, *filter)
+		if err != nil {
+			return exitError, fmt.Errorf("listing datasets: %w", err)
+		}
+	}
+
+	for i, name := range names {
+		metadata, err := bq.Get(ctx, *project, name)
+		if err != nil {
+			return exitError, fmt.Errorf("getting dataset %s: %w", name, err)
+		}
+
+		m, notes := importDataset(name, metadata, *namespace, *ownerEmail)
+		if err := writeManifest(e.stdout, *project, m, notes, i > 0); err != nil {
+			return exitError, err
+		}
+	}
+	return exitOK, nil
+}
+
+// importDataset maps the dataset to a BigQueryDataset manifest. It returns a
+// note for everything bqrator can't represent, or would change when it takes
+// over the dataset.
+func importDataset(name string, metadata *bigquery.DatasetMetadata, namespace, ownerEmail string) (manifest, []string) {
+	var notes []string
+	m := manifest{
+		APIVersion: "google.nais.io/v1",
+		Kind:       "BigQueryDataset",
+		Metadata: manifestMetadata{
+			Name:      resourceName(name),
+			Namespace: namespace,
+		},
+		Spec: manifestSpec{
+			Name:        name,
+			Location:    metadata.Location,
+			Description: metadata.Description,
+		},
+	}
+
+	if errs := validation.IsDNS1123Subdomain(m.Metadata.Name); len(errs) > 0 {
+		notes = append(notes, fmt.Sprintf("metadata.name %q is not a valid resource name: %s", m.Metadata.Name, strings.Join(errs, ", ")))
+	}
+
+	team := metadata.Labels["team"]
+	if m.Metadata.Namespace == "" {
+		m.Metadata.Namespace = team
+	}
+	switch {
+	case m.Metadata.Namespace == "":
+		notes = append(notes, "metadata.namespace is not set, as the dataset has no team label")
+	case team != m.Metadata.Namespace:
+		notes = append(notes, fmt.Sprintf("label team %q will be set to %q", team, m.Metadata.Namespace))
+	}
+	if app, ok := metadata.Labels["app"]; ok {
+		if errs := validation.IsValidLabelValue(app); len(errs) > 0 {
+			notes = append(notes, fmt.Sprintf("label app %q is not a valid resource label, and will be kept as is: %s", app, strings.Join(errs, ", ")))
+		} else {
+			m.Metadata.Labels = map[string]string{"app": app}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(metadata.Labels)) {
+		if key != "team" && key != "app" {
+			notes = append(notes, fmt.Sprintf("label %s %q can't be represented, and will be kept as is", key, metadata.Labels[key]))
+		}
+	}
+	if metadata.Name != "" && metadata.Name != name {
+		notes = append(notes, fmt.Sprintf("friendly name %q will be set to %q", metadata.Name, name))
+	}
+
+	for _, entry := range metadata.Access {
+		switch {
+		case entry.EntityType == bigquery.UserEmailEntity && strings.HasPrefix(entry.Entity, "deleted:"):
+			notes = append(notes, fmt.Sprintf("%s will be removed, as the account is deleted", controllers.FormatAccessEntry(entry)))
+		case entry.EntityType == bigquery.UserEmailEntity && entry.Entity == ownerEmail:
+			// Added by bqrator itself.
+		case entry.EntityType == bigquery.UserEmailEntity:
+			m.Spec.Access = append(m.Spec.Access, google_nais_io_v1.DatasetAccess{
+				Role:        string(entry.Role),
+				UserByEmail: entry.Entity,
+			})
+		default:
+			notes = append(notes, fmt.Sprintf("%s can't be represented, and will be kept as is", controllers.FormatAccessEntry(entry)))
+		}
+	}
+
+	return m, notes
+}
+
+// resourceName returns a Kubernetes resource name for a dataset ID, which may
+// contain upper case letters and underscores.
+func resourceName(datasetID string) string {
+	return strings.Trim(strings.ReplaceAll(strings.ToLower(datasetID), "_", "-"), "-")
+}
+
+func writeManifest(w io.Writer, projectID string, m manifest, notes []string, separator bool) error {
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	if separator {
+		sb.WriteString("---\n")
+	}
+	fmt.Fprintf(&sb, "# Imported from %s.%s\n", projectID, m.Spec.Name)
+	for _, note := range notes {
+		fmt.Fprintf(&sb, "# NOTE: %s\n", note)
+	}
+	sb.Write(b)
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
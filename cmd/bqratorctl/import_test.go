@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	e, stdout := newTestEnv(t)
+	bq, _ := e.bigQuery(ctx)
+	if err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "Other_Team", Labels: map[string]string{"team": "other"}}); err != nil {
+		t.Fatal(err)
+	}
+	err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{
+		Name:     "with_app",
+		Location: "europe-north1",
+		Labels:   map[string]string{"team": "team", "app": "myapp"},
+		Access:   []*bigquery.AccessEntry{{Role: bigquery.OwnerRole, EntityType: bigquery.UserEmailEntity, Entity: "bqrator@example.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run(ctx, []string{"import", "--project", "proj", "--filter", "labels.team:team", "--owner-email", "bqrator@example.com"}, e); code != exitOK {
+		t.Fatalf("run() = %d, want %d, stderr: %s", code, exitOK, e.stderr)
+	}
+
+	want := `# Imported from proj.existing
+# NOTE: READER group:manual@example.com can't be represented, and will be kept as is
+apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  name: existing
+  namespace: team
+spec:
+  access:
+  - role: WRITER
+    userByEmail: reader@example.com
+  description: old description
+  location: europe-north1
+  name: existing
+---
+# Imported from proj.with_app
+apiVersion: google.nais.io/v1
+kind: BigQueryDataset
+metadata:
+  labels:
+    app: myapp
+  name: with-app
+  namespace: team
+spec:
+  location: europe-north1
+  name: with_app
+`
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("unexpected output (-want +got):\n%s", diff)
+	}
+
+	// An imported dataset is taken over by bqrator without changes.
+	e.stdin = strings.NewReader(stdout.String())
+	e.stdout = &bytes.Buffer{}
+	if code := run(ctx, []string{"diff", "--project", "proj", "--owner-email", "bqrator@example.com", "-"}, e); code != exitOK {
+		t.Errorf("diff of imported manifest = %d, want %d, output:\n%s", code, exitOK, e.stdout)
+	}
+}
+
+func TestImportConfig(t *testing.T) {
+	ctx := context.Background()
+	e, stdout := newTestEnv(t)
+	kube := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"team-project": "proj"}},
+	}).Build()
+	e.kubeClient = func() (client.Reader, error) { return kube, nil }
+
+	args := []string{"import", "--namespace", "team"}
+	if code := run(ctx, append(args, "--project", "proj", "--owner-email", "bqrator@example.com", "existing"), e); code != exitOK {
+		t.Fatalf("run() = %d, want %d, stderr: %s", code, exitOK, e.stderr)
+	}
+	want := stdout.String()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ownerEmail: bqrator@example.com\nproject:\n  labelKeys: [team-project]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := run(ctx, append(args, "--config", path, "existing"), e); code != exitOK {
+		t.Fatalf("run() with --config = %d, want %d, stderr: %s", code, exitOK, e.stderr)
+	}
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("expected owner and project from --config, got (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportDataset(t *testing.T) {
+	metadata := &bigquery.DatasetMetadata{
+		Name:        "Friendly",
+		Location:    "EU",
+		Description: "legacy",
+		Labels:      map[string]string{"team": "a-team", "app": "legacy", "cost-center": "1", "env": "prod"},
+		Access: []*bigquery.AccessEntry{
+			{Role: bigquery.OwnerRole, EntityType: bigquery.UserEmailEntity, Entity: "bqrator@example.com"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.UserEmailEntity, Entity: "user@example.com"},
+			{Role: bigquery.WriterRole, EntityType: bigquery.UserEmailEntity, Entity: "deleted:serviceAccount:gone@example.com?uid=1"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.SpecialGroupEntity, Entity: "projectReaders"},
+			{EntityType: bigquery.ViewEntity, View: &bigquery.Table{ProjectID: "p", DatasetID: "d", TableID: "v"}},
+		},
+	}
+
+	m, notes := importDataset("Legacy_Data_", metadata, "b-team", "bqrator@example.com")
+
+	wantSpec := manifestSpec{
+		Name:        "Legacy_Data_",
+		Location:    "EU",
+		Description: "legacy",
+		Access:      []google_nais_io_v1.DatasetAccess{{Role: "READER", UserByEmail: "user@example.com"}},
+	}
+	if diff := cmp.Diff(wantSpec, m.Spec); diff != "" {
+		t.Errorf("unexpected spec (-want +got):\n%s", diff)
+	}
+	wantMetadata := manifestMetadata{Name: "legacy-data", Namespace: "b-team", Labels: map[string]string{"app": "legacy"}}
+	if diff := cmp.Diff(wantMetadata, m.Metadata); diff != "" {
+		t.Errorf("unexpected metadata (-want +got):\n%s", diff)
+	}
+
+	wantNotes := []string{
+		`label team "a-team" will be set to "b-team"`,
+		`label cost-center "1" can't be represented, and will be kept as is`,
+		`label env "prod" can't be represented, and will be kept as is`,
+		`friendly name "Friendly" will be set to "Legacy_Data_"`,
+		"WRITER user:deleted:serviceAccount:gone@example.com?uid=1 will be removed, as the account is deleted",
+		"READER specialGroup:projectReaders can't be represented, and will be kept as is",
+		" view:p.d.v can't be represented, and will be kept as is",
+	}
+	if diff := cmp.Diff(wantNotes, notes); diff != "" {
+		t.Errorf("unexpected notes (-want +got):\n%s", diff)
+	}
+
+	_, notes = importDataset("0_$", &bigquery.DatasetMetadata{}, "", "")
+	if len(notes) != 2 || !strings.Contains(notes[0], "not a valid resource name") || !strings.Contains(notes[1], "namespace is not set") {
+		t.Errorf("unexpected notes for dataset without team label and with invalid name: %q", notes)
+	}
+}
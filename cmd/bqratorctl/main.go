@@ -0,0 +1,129 @@
+// Command bqratorctl works with BigQueryDataset manifests and the BigQuery
+// datasets they manage, outside of the cluster.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/nais/bqrator/controllers"
+	"github.com/nais/bqrator/pkg/config"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const usage = `Usage: bqratorctl <command> [flags]
+
+Commands:
+  diff    Show the changes bqrator would make for BigQueryDataset manifests
+  import  Write BigQueryDataset manifests for existing datasets
+  orphans List, and optionally delete, datasets no BigQueryDataset manages
+
+Run bqratorctl <command> -h for the flags of a command.
+`
+
+// Exit codes follow diff(1): 1 means there are changes, 2 that something failed.
+const (
+	exitOK      = 0
+	exitChanges = 1
+	exitError   = 2
+)
+
+// env is what commands use to talk to the outside world, so that tests can
+// replace it.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	bigQuery   func(ctx context.Context) (controllers.BigQuery, error)
+	kubeClient func() (client.Reader, error)
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	os.Exit(run(ctx, os.Args[1:], env{
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		bigQuery:   newBigQuery,
+		kubeClient: newKubeClient,
+	}))
+}
+
+func run(ctx context.Context, args []string, e env) int {
+	if len(args) == 0 {
+		fmt.Fprint(e.stderr, usage)
+		return exitError
+	}
+
+	var err error
+	code := exitOK
+	switch args[0] {
+	case "diff":
+		code, err = runDiff(ctx, args[1:], e)
+	case "import":
+		code, err = runImport(ctx, args[1:], e)
+	case "orphans":
+		code, err = runOrphans(ctx, args[1:], e)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(e.stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(e.stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+
+	if err != nil {
+		fmt.Fprintf(e.stderr, "bqratorctl %s: %v\n", args[0], err)
+		return exitError
+	}
+	return code
+}
+
+const configUsage = "Path to the bqrator configuration file, so that projects are resolved like bqrator does, e.g. from a project map ConfigMap or custom namespace labels."
+
+// loadConfig returns the bqrator configuration in the file at path, or the
+// default configuration if path is empty.
+func loadConfig(path string) (config.Config, error) {
+	if path == "" {
+		return config.Default(), nil
+	}
+	return config.Load(path)
+}
+
+// newBigQuery returns a BigQuery implementation using Application Default
+// Credentials, like the operator does.
+func newBigQuery(ctx context.Context) (controllers.BigQuery, error) {
+	pool, err := controllers.NewClientPool(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &controllers.BigQueryWrapper{Clients: pool}, nil
+}
+
+// newKubeClient returns a client for the cluster in the current kubeconfig
+// context.
+func newKubeClient() (client.Reader, error) {
+	cfg, err := ctrlconfig.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := google_nais_io_v1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/nais/bqrator/controllers"
+)
+
+func runOrphans(ctx context.Context, args []string, e env) (int, error) {
+	fs := flag.NewFlagSet("orphans", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: bqratorctl orphans [flags] [project.dataset ...]\n\nLists datasets labelled with a team by bqrator, that no BigQueryDataset in the\nteam's namespace manages, in the cluster of the current kubeconfig context.\n\nWith --delete, the given datasets are deleted if they are still orphans.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	team := fs.String("team", "", "Only list orphans of this team. All teams are listed if empty.")
+	del := fs.Bool("delete", false, "Delete the orphans given as arguments. Only empty datasets can be deleted, others are reported and left as is.")
+	configPath := fs.String("config", "", configUsage)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, nil
+		}
+		return exitError, err
+	}
+	switch {
+	case *del && fs.NArg() == 0:
+		fs.Usage()
+		return exitError, errors.New("--delete needs the orphans to delete as arguments")
+	case !*del && fs.NArg() > 0:
+		fs.Usage()
+		return exitError, errors.New("unexpected arguments")
+	}
+	toDelete := map[string]bool{}
+	for _, arg := range fs.Args() {
+		if projectID, dataset, ok := strings.Cut(arg, "."); !ok || projectID == "" || dataset == "" {
+			return exitError, fmt.Errorf("%q is not a dataset on the form project.dataset", arg)
+		}
+		toDelete[arg] = true
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return exitError, err
+	}
+
+	c, err := e.kubeClient()
+	if err != nil {
+		return exitError, fmt.Errorf("creating kubernetes client: %w", err)
+	}
+	bq, err := e.bigQuery(ctx)
+	if err != nil {
+		return exitError, err
+	}
+
+	// The orphans of the teams that could be scanned are listed, and the
+	// teams that failed are reported after them.
+	orphans, scanErr := controllers.FindOrphans(ctx, c, bq, controllers.NewProjectResolver(c, cfg.Project))
+
+	// Orphans of other teams are left out with --team, so rather than being
+	// reported as not orphans, asking to delete them is an error.
+	var otherTeams []string
+	for _, orphan := range orphans {
+		if name := orphan.ProjectID + "." + orphan.Dataset; toDelete[name] && *team != "" && orphan.Team != *team {
+			otherTeams = append(otherTeams, fmt.Sprintf("%s (team %s)", name, orphan.Team))
+		}
+	}
+	if len(otherTeams) > 0 {
+		return exitError, fmt.Errorf("nothing deleted, as these orphans are not of team %s: %s", *team, strings.Join(otherTeams, ", "))
+	}
+
+	code := exitOK
+	var failed int
+	for _, orphan := range orphans {
+		if *team != "" && orphan.Team != *team {
+			continue
+		}
+
+		name := orphan.ProjectID + "." + orphan.Dataset
+		status := "orphaned"
+		if toDelete[name] {
+			delete(toDelete, name)
+			status = "deleted"
+			if err := bq.Delete(ctx, orphan.ProjectID, orphan.Dataset); err != nil {
+				status = fmt.Sprintf("not deleted: %v", err)
+				failed++
+			}
+		}
+		if status != "deleted" {
+			code = exitChanges
+		}
+		fmt.Fprintf(e.stdout, "team %s, dataset %s: %s\n", orphan.Team, name, status)
+	}
+
+	var errs []error
+	if scanErr != nil {
+		errs = append(errs, fmt.Errorf("scanning for orphans: %w", scanErr))
+	}
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%d of the orphans could not be deleted", failed))
+	}
+	if len(toDelete) > 0 {
+		errs = append(errs, fmt.Errorf("not deleted, as they are not orphans: %s", strings.Join(slices.Sorted(maps.Keys(toDelete)), ", ")))
+	}
+	if len(errs) > 0 {
+		return exitError, errors.Join(errs...)
+	}
+	return code, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOrphans(t *testing.T) {
+	ctx := context.Background()
+	e, stdout := newTestEnv(t)
+
+	kube := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"google-cloud-project": "proj"}}},
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "team"},
+			Spec:       naisv1.BigQueryDatasetSpec{Name: "existing"},
+		},
+	).Build()
+	e.kubeClient = func() (client.Reader, error) { return kube, nil }
+
+	bq, err := e.bigQuery(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"orphan", "other"} {
+		if err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: name, Labels: map[string]string{"team": "team"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := run(ctx, []string{"orphans", "--team", "other-team"}, e); code != exitOK {
+		t.Errorf("expected exit code %d without orphans for the team, got %d", exitOK, code)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("expected no orphans for other-team, got %q", stdout)
+	}
+
+	want := `team team, dataset proj.orphan: orphaned
+team team, dataset proj.other: orphaned
+`
+	if code := run(ctx, []string{"orphans"}, e); code != exitChanges {
+		t.Errorf("expected exit code %d with orphans, got %d", exitChanges, code)
+	}
+	if stdout.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", stdout, want)
+	}
+
+	stdout.Reset()
+	if code := run(ctx, []string{"orphans", "--delete"}, e); code != exitError {
+		t.Errorf("expected exit code %d for --delete without datasets, got %d", exitError, code)
+	}
+	if code := run(ctx, []string{"orphans", "--team", "other-team", "--delete", "proj.orphan"}, e); code != exitError {
+		t.Errorf("expected exit code %d for deleting an orphan of another team, got %d", exitError, code)
+	}
+	if !strings.Contains(e.stderr.(*bytes.Buffer).String(), "not of team other-team: proj.orphan (team team)") {
+		t.Errorf("expected error naming the orphan of another team, got %q", e.stderr)
+	}
+	if _, err := bq.Get(ctx, "proj", "orphan"); err != nil {
+		t.Errorf("expected orphan of another team to be left alone, got %v", err)
+	}
+	if code := run(ctx, []string{"orphans", "--delete", "proj.existing"}, e); code != exitError {
+		t.Errorf("expected exit code %d for deleting a managed dataset, got %d", exitError, code)
+	}
+	if _, err := bq.Get(ctx, "proj", "existing"); err != nil {
+		t.Errorf("expected managed dataset to be left alone, got %v", err)
+	}
+
+	stdout.Reset()
+	want = `team team, dataset proj.orphan: deleted
+team team, dataset proj.other: orphaned
+`
+	if code := run(ctx, []string{"orphans", "--delete", "proj.orphan"}, e); code != exitChanges {
+		t.Errorf("expected exit code %d with orphans left, got %d", exitChanges, code)
+	}
+	if stdout.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", stdout, want)
+	}
+	if _, err := bq.Get(ctx, "proj", "other"); err != nil {
+		t.Errorf("expected orphan not given to be left alone, got %v", err)
+	}
+
+	stdout.Reset()
+	if code := run(ctx, []string{"orphans", "--delete", "proj.other"}, e); code != exitOK {
+		t.Errorf("expected exit code %d once orphans are deleted, got %d", exitOK, code)
+	}
+
+	stdout.Reset()
+	if code := run(ctx, []string{"orphans"}, e); code != exitOK || stdout.Len() > 0 {
+		t.Errorf("expected no orphans left, got exit code %d and %q", code, stdout)
+	}
+}
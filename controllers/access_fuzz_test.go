@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// The fuzz tests below generate access lists from the fuzzer's bytes. Values
+// are picked from small pools, containing the separators a string key could
+// be confused by, so that collisions and duplicates are likely. Besides the
+// seeds, the corpus gets a fixed set of random inputs, so the properties are
+// checked for a range of access lists on every go test run.
+
+var (
+	fuzzRoles    = []bigquery.AccessRole{"", bigquery.ReaderRole, bigquery.WriterRole, bigquery.OwnerRole}
+	fuzzEntities = []string{"a@example.com", "b@example.com", "example.com", "projectReaders", "deleted:serviceAccount:c@example.com"}
+	fuzzIDs      = []string{"", "a", "b", "a/b", "b/c", "a,b", "c"}
+	fuzzTargets  = []string{"VIEWS", "ROUTINES", "VIEWS,ROUTINES"}
+)
+
+type accessGenerator struct {
+	data []byte
+}
+
+func (g *accessGenerator) next() int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b)
+}
+
+func pick[T any](g *accessGenerator, values []T) T {
+	return values[g.next()%len(values)]
+}
+
+func (g *accessGenerator) entry() *bigquery.AccessEntry {
+	role := pick(g, fuzzRoles)
+	switch g.next() % 8 {
+	case 0:
+		return &bigquery.AccessEntry{Role: role, EntityType: bigquery.UserEmailEntity, Entity: pick(g, fuzzEntities)}
+	case 1:
+		return &bigquery.AccessEntry{Role: role, EntityType: bigquery.GroupEmailEntity, Entity: pick(g, fuzzEntities)}
+	case 2:
+		return &bigquery.AccessEntry{Role: role, EntityType: bigquery.DomainEntity, Entity: pick(g, fuzzEntities)}
+	case 3:
+		return &bigquery.AccessEntry{Role: role, EntityType: bigquery.SpecialGroupEntity, Entity: pick(g, fuzzEntities)}
+	case 4:
+		return &bigquery.AccessEntry{Role: role, EntityType: bigquery.IAMMemberEntity, Entity: pick(g, fuzzEntities)}
+	case 5:
+		return &bigquery.AccessEntry{EntityType: bigquery.ViewEntity, View: &bigquery.Table{
+			ProjectID: pick(g, fuzzIDs), DatasetID: pick(g, fuzzIDs), TableID: pick(g, fuzzIDs),
+		}}
+	case 6:
+		return &bigquery.AccessEntry{EntityType: bigquery.RoutineEntity, Routine: &bigquery.Routine{
+			ProjectID: pick(g, fuzzIDs), DatasetID: pick(g, fuzzIDs), RoutineID: pick(g, fuzzIDs),
+		}}
+	default:
+		var targets []string
+		for range g.next() % 3 {
+			targets = append(targets, pick(g, fuzzTargets))
+		}
+		return &bigquery.AccessEntry{EntityType: bigquery.DatasetEntity, Dataset: &bigquery.DatasetAccessEntry{
+			Dataset:     &bigquery.Dataset{ProjectID: pick(g, fuzzIDs), DatasetID: pick(g, fuzzIDs)},
+			TargetTypes: targets,
+		}}
+	}
+}
+
+func (g *accessGenerator) list() []*bigquery.AccessEntry {
+	var access []*bigquery.AccessEntry
+	for range g.next() % 8 {
+		access = append(access, g.entry())
+	}
+	return access
+}
+
+// canonical describes an entry with all its fields, independently of keyOf.
+func canonical(e *bigquery.AccessEntry) string {
+	fields := []string{string(e.Role), fmt.Sprint(e.EntityType), e.Entity}
+	if e.View != nil {
+		fields = append(fields, "view", e.View.ProjectID, e.View.DatasetID, e.View.TableID)
+	}
+	if e.Routine != nil {
+		fields = append(fields, "routine", e.Routine.ProjectID, e.Routine.DatasetID, e.Routine.RoutineID)
+	}
+	if e.Dataset != nil {
+		targets := slices.Sorted(slices.Values(e.Dataset.TargetTypes))
+		fields = append(fields, "dataset", e.Dataset.Dataset.ProjectID, e.Dataset.Dataset.DatasetID)
+		fields = append(fields, targets...)
+	}
+	return fmt.Sprintf("%q", fields)
+}
+
+// multisetEqual is the reference accessSetEqual is checked against.
+func multisetEqual(a, b []*bigquery.AccessEntry) bool {
+	ca := make([]string, 0, len(a))
+	for _, e := range a {
+		ca = append(ca, canonical(e))
+	}
+	cb := make([]string, 0, len(b))
+	for _, e := range b {
+		cb = append(cb, canonical(e))
+	}
+	slices.Sort(ca)
+	slices.Sort(cb)
+	return slices.Equal(ca, cb)
+}
+
+func shuffled(access []*bigquery.AccessEntry, seed int) []*bigquery.AccessEntry {
+	access = slices.Clone(access)
+	r := rand.New(rand.NewPCG(uint64(seed), 0))
+	r.Shuffle(len(access), func(i, j int) { access[i], access[j] = access[j], access[i] })
+	return access
+}
+
+func addAccessCorpus(f *testing.F) {
+	r := rand.New(rand.NewPCG(44, 44))
+	for range 200 {
+		data := make([]byte, 64)
+		for i := range data {
+			data[i] = byte(r.IntN(256))
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzAccessSetEqual(f *testing.F) {
+	// [x, x] against [x, y].
+	f.Add([]byte{2, 1, 0, 0, 1, 0, 0, 2, 1, 0, 0, 1, 0, 1})
+	// Views a/b.c and a.b/c, which collide when joined with "/".
+	f.Add([]byte{1, 0, 5, 3, 6, 0, 1, 0, 5, 1, 4, 0})
+	addAccessCorpus(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g := &accessGenerator{data: data}
+		a, b := g.list(), g.list()
+		seed := g.next()
+
+		if got, want := accessSetEqual(a, b), multisetEqual(a, b); got != want {
+			t.Errorf("accessSetEqual(%s, %s) = %v, want %v", formatAccess(a), formatAccess(b), got, want)
+		}
+		if accessSetEqual(a, b) != accessSetEqual(b, a) {
+			t.Errorf("accessSetEqual is not symmetric for %s and %s", formatAccess(a), formatAccess(b))
+		}
+		if !accessSetEqual(a, shuffled(a, seed)) {
+			t.Errorf("accessSetEqual depends on order for %s", formatAccess(a))
+		}
+	})
+}
+
+func FuzzMergeAccess(f *testing.F) {
+	f.Add([]byte{2, 0, 1, 0, 0, 0, 1, 0, 0, 1, 2, 0, 1, 1, 1, 0, 5, 0, 0, 0, 1})
+	addAccessCorpus(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g := &accessGenerator{data: data}
+		desired, existing := g.list(), g.list()
+		owner := pick(g, []string{"", "a@example.com", "bqrator@example.com"})
+		seed := g.next()
+
+		merged := mergeAccess(desired, existing, owner)
+		describe := func() string {
+			return fmt.Sprintf("desired %s, existing %s, owner %q, merged %s", formatAccess(desired), formatAccess(existing), owner, formatAccess(merged))
+		}
+
+		if other := mergeAccess(shuffled(desired, seed), shuffled(existing, seed+1), owner); !accessSetEqual(merged, other) {
+			t.Errorf("merge depends on order: %s, got %s after shuffling", describe(), formatAccess(other))
+		}
+		// BigQuery returns what was written, so merging again must be a no-op,
+		// or the reconciler would update the dataset on every resync.
+		if again := mergeAccess(desired, merged, owner); !accessSetEqual(merged, again) {
+			t.Errorf("merge is not idempotent: %s, got %s when merging again", describe(), formatAccess(again))
+		}
+
+		keys := map[accessEntryKey]bool{}
+		for _, e := range merged {
+			if keys[keyOf(e)] {
+				t.Errorf("merge has duplicates: %s", describe())
+			}
+			keys[keyOf(e)] = true
+		}
+		for _, e := range desired {
+			if !keys[keyOf(e)] {
+				t.Errorf("merge is missing desired entry %s: %s", FormatAccessEntry(e), describe())
+			}
+		}
+		if owner != "" && !slices.ContainsFunc(merged, func(e *bigquery.AccessEntry) bool { return e.Entity == owner }) {
+			t.Errorf("merge is missing owner: %s", describe())
+		}
+	})
+}
+
+func formatAccess(access []*bigquery.AccessEntry) string {
+	s := make([]string, 0, len(access))
+	for _, e := range access {
+		s = append(s, canonical(e))
+	}
+	return fmt.Sprint(s)
+}
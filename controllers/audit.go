@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/go-logr/logr"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Audit actions for access entries.
+const (
+	auditActionAdd    = "add"
+	auditActionKeep   = "keep"
+	auditActionRemove = "remove"
+)
+
+// AuditRecord describes one access entry that bqrator added, kept or removed
+// on a dataset in BigQuery. Kept entries are only recorded along with changes
+// to the dataset, and all entries are removed when a dataset is deleted.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+
+	Role       string `json:"role"`
+	EntityType string `json:"entityType"`
+	Entity     string `json:"entity"`
+
+	ProjectID       string    `json:"projectId"`
+	BigQueryDataset string    `json:"bigQueryDataset"`
+	Namespace       string    `json:"namespace"`
+	Name            string    `json:"name"`
+	UID             types.UID `json:"uid"`
+	Generation      int64     `json:"generation"`
+
+	// Operator is the identity bqrator uses to make the change.
+	Operator string `json:"operator"`
+	// DryRun is true if the change was only planned, not made.
+	DryRun bool `json:"dryRun"`
+}
+
+// AuditSink receives the audit records of a synchronization.
+type AuditSink interface {
+	Audit(ctx context.Context, records []AuditRecord) error
+}
+
+// LogAuditSink writes each audit record as a structured log line.
+type LogAuditSink struct {
+	Log logr.Logger
+}
+
+var _ AuditSink = &LogAuditSink{}
+
+func (l *LogAuditSink) Audit(_ context.Context, records []AuditRecord) error {
+	for _, record := range records {
+		l.Log.Info("Access entry "+record.Action,
+			"action", record.Action,
+			"role", record.Role,
+			"entityType", record.EntityType,
+			"entity", record.Entity,
+			"projectId", record.ProjectID,
+			"bigQueryDataset", record.BigQueryDataset,
+			"namespace", record.Namespace,
+			"name", record.Name,
+			"uid", record.UID,
+			"generation", record.Generation,
+			"operator", record.Operator,
+			"dryRun", record.DryRun,
+		)
+	}
+	return nil
+}
+
+// FileAuditSink appends audit records to a file as JSON lines.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ AuditSink = &FileAuditSink{}
+
+// NewFileAuditSink opens path for appending, creating it if necessary.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+func (f *FileAuditSink) Audit(_ context.Context, records []AuditRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	enc := json.NewEncoder(f.file)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileAuditSink) Close() error {
+	return f.file.Close()
+}
+
+// AuditSinks writes audit records to every sink.
+type AuditSinks []AuditSink
+
+var _ AuditSink = AuditSinks{}
+
+func (s AuditSinks) Audit(ctx context.Context, records []AuditRecord) error {
+	var errs []error
+	for _, sink := range s {
+		errs = append(errs, sink.Audit(ctx, records))
+	}
+	return errors.Join(errs...)
+}
+
+// auditRecords returns an audit record for every access entry in diff.
+func auditRecords(dataset google_nais_io_v1.BigQueryDataset, diff datasetDiff, operator string, dryRun bool) []AuditRecord {
+	now := time.Now()
+	var records []AuditRecord
+	add := func(action string, entries []*bigquery.AccessEntry) {
+		for _, entry := range entries {
+			entityType, entity := accessEntity(entry)
+			records = append(records, AuditRecord{
+				Time:            now,
+				Action:          action,
+				Role:            string(entry.Role),
+				EntityType:      entityType,
+				Entity:          entity,
+				ProjectID:       dataset.Spec.Project,
+				BigQueryDataset: dataset.Spec.Name,
+				Namespace:       dataset.Namespace,
+				Name:            dataset.Name,
+				UID:             dataset.UID,
+				Generation:      dataset.Generation,
+				Operator:        operator,
+				DryRun:          dryRun,
+			})
+		}
+	}
+
+	add(auditActionAdd, diff.AccessAdd)
+	add(auditActionKeep, diff.AccessKeep)
+	add(auditActionRemove, diff.AccessRemove)
+	return records
+}
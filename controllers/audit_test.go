@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditRecords(t *testing.T) {
+	dataset := naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "ds",
+			Namespace:  "team",
+			UID:        "1234",
+			Generation: 3,
+		},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:    "bq_ds",
+			Project: "proj",
+		},
+	}
+	diff := datasetDiff{
+		AccessAdd:    []*bigquery.AccessEntry{{Role: bigquery.ReaderRole, EntityType: bigquery.UserEmailEntity, Entity: "new@example.com"}},
+		AccessKeep:   []*bigquery.AccessEntry{{Role: bigquery.OwnerRole, EntityType: bigquery.UserEmailEntity, Entity: "bqrator@example.com"}},
+		AccessRemove: []*bigquery.AccessEntry{{Role: bigquery.ReaderRole, View: &bigquery.Table{ProjectID: "p", DatasetID: "d", TableID: "t"}}},
+	}
+
+	records := auditRecords(dataset, diff, "bqrator@example.com", false)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	want := []struct{ action, entityType, entity string }{
+		{auditActionAdd, "user", "new@example.com"},
+		{auditActionKeep, "user", "bqrator@example.com"},
+		{auditActionRemove, "view", "p.d.t"},
+	}
+	for i, w := range want {
+		got := records[i]
+		if got.Action != w.action || got.EntityType != w.entityType || got.Entity != w.entity {
+			t.Errorf("record %d: expected %s %s:%s, got %s %s:%s", i, w.action, w.entityType, w.entity, got.Action, got.EntityType, got.Entity)
+		}
+		if got.UID != "1234" || got.Generation != 3 || got.ProjectID != "proj" || got.BigQueryDataset != "bq_ds" || got.Operator != "bqrator@example.com" {
+			t.Errorf("record %d: unexpected dataset or operator fields: %+v", i, got)
+		}
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []AuditRecord{
+		{Action: auditActionAdd, Entity: "a@example.com"},
+		{Action: auditActionRemove, Entity: "b@example.com"},
+	}
+	if err := sink.Audit(context.Background(), records[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Audit(context.Background(), records[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var got []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, record)
+	}
+
+	if len(got) != 2 || got[0].Entity != "a@example.com" || got[1].Action != auditActionRemove {
+		t.Errorf("unexpected records in audit file: %+v", got)
+	}
+}
+
+type recordingAuditSink struct {
+	records []AuditRecord
+}
+
+func (r *recordingAuditSink) Audit(_ context.Context, records []AuditRecord) error {
+	r.records = append(r.records, records...)
+	return nil
+}
+
+func TestReconcilerAudit(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := namespaceWithServiceAccount("team", "team@proj.iam.gserviceaccount.com")
+	namespace.Labels = map[string]string{namespaceProjectLabel: "proj"}
+	key := types.NamespacedName{Namespace: "team", Name: "ds"}
+	c := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&naisv1.BigQueryDataset{}).WithObjects(
+		namespace,
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec: naisv1.BigQueryDatasetSpec{
+				Name:            "ds",
+				Location:        "europe-north1",
+				CascadingDelete: true,
+				Access:          []naisv1.DatasetAccess{{Role: "READER", UserByEmail: "reader@example.com"}},
+			},
+		},
+	).Build()
+
+	_, bq := newFakeBigQuery(t)
+	sink := &recordingAuditSink{}
+	identity := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation, Fallback: &ClientPool{Email: "bqrator@example.com"}}
+	r := NewBigQueryDatasetReconciler(c, s, bq, WithAuditSink(sink), WithIdentity(identity))
+
+	actions := func() []string {
+		var actions []string
+		for _, record := range sink.records {
+			if record.Operator != "team@proj.iam.gserviceaccount.com" {
+				t.Errorf("expected the impersonated service account as operator, got %q", record.Operator)
+			}
+			actions = append(actions, record.Action+" "+record.Entity)
+		}
+		sink.records = nil
+		return actions
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"add reader@example.com"}, actions()); diff != "" {
+		t.Errorf("unexpected audit records on create (-want +got):\n%s", diff)
+	}
+
+	var dataset naisv1.BigQueryDataset
+	if err := c.Get(ctx, key, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	dataset.Spec.Project = "proj"
+	if err := r.onUpdate(ContextWithNamespace(ctx, key.Namespace), dataset, dataset.Status.SynchronizationHash); err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(); len(got) > 0 {
+		t.Errorf("expected no audit records without changes, got %v", got)
+	}
+
+	if err := c.Delete(ctx, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"remove reader@example.com"}, actions()); diff != "" {
+		t.Errorf("unexpected audit records on delete (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ClientPool keeps one BigQuery client per target project and identity. Each
+// client uses its project as quota project, so that API usage is attributed to
+// the team owning the dataset rather than to the operator. All clients share
+// the same HTTP transport, and the clients of an identity share its token
+// source.
+//
+// Clients that haven't been used for IdleTimeout are closed when the pool is
+// running, see Start. A zero IdleTimeout keeps clients until the pool stops.
+type ClientPool struct {
+	TokenSource oauth2.TokenSource
+	Transport   http.RoundTripper
+	IdleTimeout time.Duration
+	// ClientOptions are passed to every client created by the pool.
+	ClientOptions []option.ClientOption
+	// Email is the identity of TokenSource.
+	Email string
+	// ProjectID is the project of the credentials of TokenSource, if known.
+	ProjectID string
+	// NewTokenSource returns a token source with the same credentials as
+	// TokenSource, but without its cached token, so that Ping can check that
+	// tokens can still be acquired. If nil, Ping uses TokenSource.
+	NewTokenSource func(ctx context.Context) (oauth2.TokenSource, error)
+	// Impersonate returns a token source for a Google service account. If nil,
+	// the service account is impersonated using TokenSource.
+	Impersonate func(serviceAccount string) (oauth2.TokenSource, error)
+
+	mu           sync.Mutex
+	clients      map[clientKey]*pooledClient
+	tokenSources map[string]oauth2.TokenSource
+	now          func() time.Time
+}
+
+// clientKey identifies a pooled client. An empty service account is the
+// pool's own identity.
+type clientKey struct {
+	serviceAccount string
+	projectID      string
+}
+
+type pooledClient struct {
+	client   *bigquery.Client
+	lastUsed time.Time
+}
+
+var (
+	_ ClientFactory = &ClientPool{}
+	_ Identifier    = &ClientPool{}
+)
+
+// NewClientPool returns a pool using Application Default Credentials.
+func NewClientPool(ctx context.Context, idleTimeout time.Duration) (*ClientPool, error) {
+	creds, err := google.FindDefaultCredentials(ctx, bigquery.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientPool{
+		TokenSource: creds.TokenSource,
+		ProjectID:   creds.ProjectID,
+		Transport:   http.DefaultTransport.(*http.Transport).Clone(),
+		IdleTimeout: idleTimeout,
+		NewTokenSource: func(ctx context.Context) (oauth2.TokenSource, error) {
+			return google.DefaultTokenSource(ctx, bigquery.Scope)
+		},
+	}, nil
+}
+
+func (p *ClientPool) Client(ctx context.Context, projectID string) (*bigquery.Client, error) {
+	return p.ImpersonatingClient(ctx, "", projectID)
+}
+
+func (p *ClientPool) Identity(context.Context) (string, error) {
+	return p.Email, nil
+}
+
+// ImpersonatingClient returns the client for projectID that impersonates
+// serviceAccount, or uses the pool's own identity if serviceAccount is empty.
+func (p *ClientPool) ImpersonatingClient(_ context.Context, serviceAccount, projectID string) (*bigquery.Client, error) {
+	key := clientKey{serviceAccount: serviceAccount, projectID: projectID}
+	if client, ok := p.pooled(key); ok {
+		return client, nil
+	}
+
+	// Creating token sources and clients is done without holding the lock, so
+	// that calls for other clients aren't held up meanwhile.
+	ts, err := p.tokenSource(serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("impersonating %s: %w", serviceAccount, err)
+	}
+
+	base := p.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient := &http.Client{
+		Transport: &quotaProjectTransport{
+			projectID: projectID,
+			base:      &oauth2.Transport{Source: ts, Base: base},
+		},
+	}
+
+	opts := append([]option.ClientOption{option.WithHTTPClient(httpClient)}, p.ClientOptions...)
+	client, err := bigquery.NewClient(context.Background(), projectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pooled, ok := p.clients[key]; ok {
+		// Another call created the same client in the meantime.
+		_ = client.Close()
+		pooled.lastUsed = p.timeNow()
+		return pooled.client, nil
+	}
+	if p.clients == nil {
+		p.clients = map[clientKey]*pooledClient{}
+	}
+	p.clients[key] = &pooledClient{client: client, lastUsed: p.timeNow()}
+	return client, nil
+}
+
+// pooled returns the pooled client for key, if there is one.
+func (p *ClientPool) pooled(key clientKey) (*bigquery.Client, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled, ok := p.clients[key]
+	if !ok {
+		return nil, false
+	}
+	pooled.lastUsed = p.timeNow()
+	return pooled.client, true
+}
+
+// tokenSource returns the token source shared by the clients of
+// serviceAccount, creating it if needed.
+func (p *ClientPool) tokenSource(serviceAccount string) (oauth2.TokenSource, error) {
+	if serviceAccount == "" {
+		return p.TokenSource, nil
+	}
+
+	p.mu.Lock()
+	ts, ok := p.tokenSources[serviceAccount]
+	p.mu.Unlock()
+	if ok {
+		return ts, nil
+	}
+
+	impersonate := p.Impersonate
+	if impersonate == nil {
+		impersonate = p.impersonate
+	}
+	ts, err := impersonate(serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if existing, ok := p.tokenSources[serviceAccount]; ok {
+		return existing, nil
+	}
+	if p.tokenSources == nil {
+		p.tokenSources = map[string]oauth2.TokenSource{}
+	}
+	p.tokenSources[serviceAccount] = ts
+	return ts, nil
+}
+
+// impersonate returns a token source impersonating serviceAccount with the
+// pool's own credentials. Tokens are reused until they expire.
+func (p *ClientPool) impersonate(serviceAccount string) (oauth2.TokenSource, error) {
+	// The token source outlives the call it is created in, so it must not use
+	// its context for refreshing tokens.
+	return impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+		TargetPrincipal: serviceAccount,
+		Scopes:          []string{bigquery.Scope},
+	}, option.WithTokenSource(p.TokenSource))
+}
+
+// Ping checks that a new token can be acquired, and, if projectID is set, that
+// datasets can be listed in the project. It gives up when ctx is done.
+func (p *ClientPool) Ping(ctx context.Context, projectID string) error {
+	if err := p.acquireToken(ctx); err != nil {
+		return fmt.Errorf("acquiring token: %w", err)
+	}
+	if projectID == "" {
+		return nil
+	}
+
+	client, err := p.Client(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	it := client.Datasets(ctx)
+	it.PageInfo().MaxSize = 1
+	if _, err := it.Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("listing datasets in %s: %w", projectID, err)
+	}
+	return nil
+}
+
+// acquireToken acquires a token from a new token source, so that a cached
+// token doesn't hide credentials that no longer work.
+func (p *ClientPool) acquireToken(ctx context.Context) error {
+	ts := p.TokenSource
+	if p.NewTokenSource != nil {
+		var err error
+		if ts, err = p.NewTokenSource(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Token sources don't take a context, so the token is acquired in the
+	// background to be able to give up on it.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ts.Token()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start closes idle clients until ctx is cancelled, and then closes all
+// clients. It implements manager.Runnable.
+func (p *ClientPool) Start(ctx context.Context) error {
+	interval := p.IdleTimeout / 2
+	if interval <= 0 {
+		<-ctx.Done()
+		p.evict(func(*pooledClient) bool { return true })
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.evict(func(*pooledClient) bool { return true })
+			return nil
+		case <-ticker.C:
+			idleSince := p.timeNow().Add(-p.IdleTimeout)
+			if n := p.evict(func(c *pooledClient) bool { return c.lastUsed.Before(idleSince) }); n > 0 {
+				log.FromContext(ctx).V(1).Info("Closed idle BigQuery clients", "count", n)
+			}
+		}
+	}
+}
+
+// evict closes and removes the clients matching shouldEvict, and returns the
+// number of clients removed. Token sources of service accounts without any
+// clients left are dropped as well.
+func (p *ClientPool) evict(shouldEvict func(*pooledClient) bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	inUse := map[string]bool{}
+	for key, pooled := range p.clients {
+		if !shouldEvict(pooled) {
+			inUse[key.serviceAccount] = true
+			continue
+		}
+		_ = pooled.client.Close()
+		delete(p.clients, key)
+		n++
+	}
+	for serviceAccount := range p.tokenSources {
+		if !inUse[serviceAccount] {
+			delete(p.tokenSources, serviceAccount)
+		}
+	}
+	return n
+}
+
+func (p *ClientPool) timeNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// quotaProjectTransport sets the quota project on every request. The option
+// for this in the client libraries is ignored when using a custom HTTP client.
+type quotaProjectTransport struct {
+	projectID string
+	base      http.RoundTripper
+}
+
+func (t *quotaProjectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Goog-User-Project", t.projectID)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClientPool(t *testing.T) {
+	ctx := context.Background()
+
+	var quotaProject, authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotaProject = r.Header.Get("X-Goog-User-Project")
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Not found"}}`))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	pool := &ClientPool{
+		TokenSource:   oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		IdleTimeout:   time.Minute,
+		ClientOptions: []option.ClientOption{option.WithEndpoint(srv.URL)},
+		now:           func() time.Time { return now },
+	}
+
+	a, err := pool.Client(ctx, "project-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.Client(ctx, "project-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("clients are reused per project", func(t *testing.T) {
+		again, err := pool.Client(ctx, "project-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != a {
+			t.Error("expected the same client for the same project")
+		}
+		if a == b {
+			t.Error("expected different clients for different projects")
+		}
+	})
+
+	t.Run("requests use the project as quota project", func(t *testing.T) {
+		_, _ = (&BigQueryWrapper{Clients: pool}).Get(ctx, "project-b", "dataset")
+		if quotaProject != "project-b" {
+			t.Errorf("expected quota project %q, got %q", "project-b", quotaProject)
+		}
+		if authorization != "Bearer token" {
+			t.Errorf("expected shared token to be used, got %q", authorization)
+		}
+	})
+
+	t.Run("impersonating clients are pooled per service account and project", func(t *testing.T) {
+		pool.Impersonate = func(serviceAccount string) (oauth2.TokenSource, error) {
+			return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-" + serviceAccount}), nil
+		}
+
+		x, err := pool.ImpersonatingClient(ctx, "sa-x", "project-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x == a {
+			t.Error("expected impersonating client to differ from the pool's own")
+		}
+		again, err := pool.ImpersonatingClient(ctx, "sa-x", "project-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != x {
+			t.Error("expected the same client for the same service account and project")
+		}
+
+		_, _ = (&BigQueryWrapper{Clients: &ImpersonatingClientFactory{
+			Reader:     fake.NewClientBuilder().WithObjects(namespaceWithServiceAccount("team", "sa-y")).Build(),
+			Annotation: impersonationAnnotation,
+			Clients:    pool,
+		}}).Get(ContextWithNamespace(ctx, "team"), "project-b", "dataset")
+		if quotaProject != "project-b" {
+			t.Errorf("expected quota project %q, got %q", "project-b", quotaProject)
+		}
+		if authorization != "Bearer token-sa-y" {
+			t.Errorf("expected impersonated token to be used, got %q", authorization)
+		}
+		if len(pool.tokenSources) != 2 {
+			t.Errorf("expected a token source per service account, got %d", len(pool.tokenSources))
+		}
+	})
+
+	t.Run("idle clients are evicted", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		if _, err := pool.Client(ctx, "project-a"); err != nil {
+			t.Fatal(err)
+		}
+
+		idleSince := now.Add(-pool.IdleTimeout)
+		if n := pool.evict(func(c *pooledClient) bool { return c.lastUsed.Before(idleSince) }); n != 3 {
+			t.Errorf("expected 3 evicted clients, got %d", n)
+		}
+		if len(pool.tokenSources) != 0 {
+			t.Errorf("expected token sources without clients to be dropped, got %d", len(pool.tokenSources))
+		}
+
+		again, err := pool.Client(ctx, "project-b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again == b {
+			t.Error("expected a new client after eviction")
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/metrics"
+	"google.golang.org/api/googleapi"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DryRunBigQuery passes reads through to the wrapped BigQuery implementation,
+// but only logs and records the Create, Update and Delete calls it receives.
+type DryRunBigQuery struct {
+	BigQuery BigQuery
+
+	mu      sync.Mutex
+	planned map[string]string
+}
+
+var _ BigQuery = &DryRunBigQuery{}
+
+func NewDryRunBigQuery(bq BigQuery) *DryRunBigQuery {
+	return &DryRunBigQuery{
+		BigQuery: bq,
+		planned:  map[string]string{},
+	}
+}
+
+func (d *DryRunBigQuery) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
+	return d.BigQuery.Get(ctx, projectID, name)
+}
+
+// Create returns a 409 error if the dataset already exists, like the real API
+// would, so that the reconciler takes the same path as it would without dry-run.
+// Only a dataset that isn't found would be created, other errors from Get are
+// returned as is.
+func (d *DryRunBigQuery) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
+	_, err := d.BigQuery.Get(ctx, projectID, dataset.Name)
+	if err == nil {
+		return &googleapi.Error{
+			Code:    409,
+			Message: dataset.Name + " already exists",
+		}
+	}
+	if gerr := (*googleapi.Error)(nil); !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		return err
+	}
+
+	d.record(ctx, "create", projectID, dataset.Name, fmt.Sprintf("Would create dataset %s in project %s", dataset.Name, projectID))
+	return nil
+}
+
+func (d *DryRunBigQuery) Update(ctx context.Context, projectID, name string, _ bigquery.DatasetMetadataToUpdate, _ string) error {
+	d.record(ctx, "update", projectID, name, fmt.Sprintf("Would update dataset %s in project %s", name, projectID))
+	return nil
+}
+
+// Delete returns the error from Get if the dataset can't be found, like the real
+// API would.
+func (d *DryRunBigQuery) Delete(ctx context.Context, projectID, name string) error {
+	if _, err := d.BigQuery.Get(ctx, projectID, name); err != nil {
+		return err
+	}
+
+	d.record(ctx, "delete", projectID, name, fmt.Sprintf("Would delete dataset %s in project %s", name, projectID))
+	return nil
+}
+
+func (d *DryRunBigQuery) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	return d.BigQuery.List(ctx, projectID, filter)
+}
+
+// PlannedAction returns and forgets the last action recorded for the dataset.
+func (d *DryRunBigQuery) PlannedAction(projectID, name string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := projectID + "/" + name
+	action, ok := d.planned[key]
+	delete(d.planned, key)
+	return action, ok
+}
+
+func (d *DryRunBigQuery) record(ctx context.Context, operation, projectID, name, action string) {
+	log.FromContext(ctx).Info("Dry-run, skipping BigQuery call", "operation", operation, "project", projectID, "dataset", name)
+	metrics.BigQueryDryRunCalls.WithLabelValues(operation).Inc()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.planned[projectID+"/"+name] = action
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRunBigQuery(t *testing.T) {
+	ctx := context.Background()
+	server, bq := newFakeBigQuery(t)
+	dryRun := NewDryRunBigQuery(bq)
+
+	t.Run("create is recorded but not executed", func(t *testing.T) {
+		if err := dryRun.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "new"}); err != nil {
+			t.Fatal(err)
+		}
+		if server.HasDataset("proj", "new") {
+			t.Error("expected dataset not to be created")
+		}
+
+		action, ok := dryRun.PlannedAction("proj", "new")
+		if !ok {
+			t.Fatal("expected a planned action")
+		}
+		if action != "Would create dataset new in project proj" {
+			t.Errorf("unexpected planned action %q", action)
+		}
+		if _, ok := dryRun.PlannedAction("proj", "new"); ok {
+			t.Error("expected planned action to be forgotten after it was read")
+		}
+	})
+
+	t.Run("create of existing dataset returns conflict", func(t *testing.T) {
+		if err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "existing"}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := dryRun.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "existing"})
+		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != 409 {
+			t.Errorf("expected 409 error, got %v", err)
+		}
+	})
+
+	t.Run("create returns errors other than not found", func(t *testing.T) {
+		faulty := NewFaultyBigQuery(bq)
+		faulty.Inject(Fault{Method: "Get", Dataset: "forbidden", Code: http.StatusForbidden})
+
+		err := NewDryRunBigQuery(faulty).Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "forbidden"})
+		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != http.StatusForbidden {
+			t.Errorf("expected 403 error, got %v", err)
+		}
+	})
+
+	t.Run("update and delete are recorded but not executed", func(t *testing.T) {
+		if err := dryRun.Update(ctx, "proj", "existing", bigquery.DatasetMetadataToUpdate{Description: "changed"}, ""); err != nil {
+			t.Fatal(err)
+		}
+		if server.Requests(http.MethodPatch) != 0 {
+			t.Error("expected no update call")
+		}
+		if _, ok := dryRun.PlannedAction("proj", "existing"); !ok {
+			t.Error("expected a planned update")
+		}
+
+		if err := dryRun.Delete(ctx, "proj", "existing"); err != nil {
+			t.Fatal(err)
+		}
+		if !server.HasDataset("proj", "existing") {
+			t.Error("expected dataset not to be deleted")
+		}
+		if action, _ := dryRun.PlannedAction("proj", "existing"); action != "Would delete dataset existing in project proj" {
+			t.Errorf("unexpected planned action %q", action)
+		}
+	})
+}
+
+func TestDryRunReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Namespace: "team", Name: "ds"}
+	c := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&naisv1.BigQueryDataset{}).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   key.Namespace,
+			Labels: map[string]string{namespaceProjectLabel: "proj"},
+		}},
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec:       naisv1.BigQueryDatasetSpec{Name: "ds", Location: "europe-north1"},
+			Status: naisv1.BigQueryDatasetStatus{Conditions: []metav1.Condition{
+				{Type: "Paused", Status: metav1.ConditionTrue, Reason: "PausedByAnnotation"},
+			}},
+		},
+	).Build()
+
+	server, bq := newFakeBigQuery(t)
+	dryRun := NewDryRunBigQuery(bq)
+	r := NewBigQueryDatasetReconciler(c, s, dryRun, WithDryRun(dryRun))
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.HasDataset("proj", "ds") {
+		t.Error("expected dataset not to be created")
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		if n := server.Requests(method); n != 0 {
+			t.Errorf("expected no %s requests, got %d", method, n)
+		}
+	}
+
+	var dataset naisv1.BigQueryDataset
+	if err := c.Get(ctx, key, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	if len(dataset.Finalizers) > 0 || metav1.HasAnnotation(dataset.ObjectMeta, projectAnnotation) {
+		t.Errorf("expected dataset metadata to be left alone, got %+v", dataset.ObjectMeta)
+	}
+	if meta.FindStatusCondition(dataset.Status.Conditions, "Paused") == nil {
+		t.Error("expected paused condition not to be removed in dry-run mode")
+	}
+	condition := meta.FindStatusCondition(dataset.Status.Conditions, "DryRun")
+	if condition == nil {
+		t.Fatal("expected DryRun condition")
+	}
+	if condition.Reason != "ChangesPlanned" || condition.Message != "Would create dataset ds in project proj" {
+		t.Errorf("unexpected DryRun condition %+v", condition)
+	}
+}
+
+func TestDryRunReconcileDelete(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Namespace: "team", Name: "ds"}
+	c := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&naisv1.BigQueryDataset{}).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   key.Namespace,
+			Labels: map[string]string{namespaceProjectLabel: "proj"},
+		}},
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   key.Namespace,
+				Name:        key.Name,
+				Finalizers:  []string{finalizer},
+				Annotations: map[string]string{projectAnnotation: "proj"},
+			},
+			Spec: naisv1.BigQueryDatasetSpec{Name: "ds", Location: "europe-north1", CascadingDelete: true},
+		},
+	).Build()
+
+	server, bq := newFakeBigQuery(t)
+	if err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "ds", Location: "europe-north1"}); err != nil {
+		t.Fatal(err)
+	}
+	dryRun := NewDryRunBigQuery(bq)
+	r := NewBigQueryDatasetReconciler(c, s, dryRun, WithDryRun(dryRun))
+
+	var dataset naisv1.BigQueryDataset
+	if err := c.Get(ctx, key, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Get(ctx, key, &dataset); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed and the resource to be gone, got %v and %+v", err, dataset.ObjectMeta)
+	}
+	if n := server.Requests(http.MethodDelete); n != 0 {
+		t.Errorf("expected no delete requests, got %d", n)
+	}
+	if !server.HasDataset("proj", "ds") {
+		t.Error("expected dataset to be kept in BigQuery")
+	}
+}
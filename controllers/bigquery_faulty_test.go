@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// Fault describes a fault injected by FaultyBigQuery.
+type Fault struct {
+	// Method is the BigQuery method the fault applies to, or empty for all.
+	Method string
+	// Dataset is the name of the dataset the fault applies to, or empty for all.
+	Dataset string
+	// Latency is added before the call is made.
+	Latency time.Duration
+	// Code is the HTTP status code of the error returned, or 0 to return the
+	// result of the call.
+	Code int
+	// Partial passes the call on before returning the error, like a response
+	// that is lost after BigQuery has applied the change.
+	Partial bool
+	// Times is the number of calls the fault applies to, or 0 for every call.
+	Times int
+}
+
+// FaultyBigQuery wraps a BigQuery implementation and injects faults into the
+// calls it receives, to test that the reconciler copes with an unreliable API.
+type FaultyBigQuery struct {
+	BigQuery BigQuery
+
+	mu         sync.Mutex
+	faults     []*Fault
+	staleReads map[string]int
+	pending    map[string]int
+	calls      map[string]int
+}
+
+var _ BigQuery = &FaultyBigQuery{}
+
+func NewFaultyBigQuery(bq BigQuery) *FaultyBigQuery {
+	return &FaultyBigQuery{
+		BigQuery:   bq,
+		staleReads: map[string]int{},
+		pending:    map[string]int{},
+		calls:      map[string]int{},
+	}
+}
+
+// Inject adds a fault. Faults are matched in the order they were added.
+func (f *FaultyBigQuery) Inject(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// StaleReadsAfterCreate makes the given number of Get calls following a
+// successful Create of the dataset return 404, like an eventually consistent
+// API would.
+func (f *FaultyBigQuery) StaleReadsAfterCreate(dataset string, reads int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.staleReads[dataset] = reads
+}
+
+// Clear removes all faults for the dataset.
+func (f *FaultyBigQuery) Clear(dataset string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = slices.DeleteFunc(f.faults, func(fault *Fault) bool { return fault.Dataset == dataset })
+	delete(f.staleReads, dataset)
+	delete(f.pending, dataset)
+}
+
+// Calls returns the number of calls made to method for the dataset, including
+// those that failed.
+func (f *FaultyBigQuery) Calls(method, dataset string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method+"/"+dataset]
+}
+
+func (f *FaultyBigQuery) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
+	var md *bigquery.DatasetMetadata
+	err := f.call(ctx, "Get", name, func() (err error) {
+		if f.stale(name) {
+			return &googleapi.Error{Code: http.StatusNotFound, Message: "Not found: Dataset " + projectID + ":" + name}
+		}
+		md, err = f.BigQuery.Get(ctx, projectID, name)
+		return err
+	})
+	return md, err
+}
+
+func (f *FaultyBigQuery) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
+	return f.call(ctx, "Create", dataset.Name, func() error {
+		if err := f.BigQuery.Create(ctx, projectID, dataset); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if reads, ok := f.staleReads[dataset.Name]; ok {
+			f.pending[dataset.Name] = reads
+		}
+		return nil
+	})
+}
+
+func (f *FaultyBigQuery) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error {
+	return f.call(ctx, "Update", name, func() error {
+		return f.BigQuery.Update(ctx, projectID, name, dataset, etag)
+	})
+}
+
+func (f *FaultyBigQuery) Delete(ctx context.Context, projectID, name string) error {
+	return f.call(ctx, "Delete", name, func() error {
+		return f.BigQuery.Delete(ctx, projectID, name)
+	})
+}
+
+func (f *FaultyBigQuery) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	var names []string
+	err := f.call(ctx, "List", "", func() (err error) {
+		names, err = f.BigQuery.List(ctx, projectID, filter)
+		return err
+	})
+	return names, err
+}
+
+func (f *FaultyBigQuery) call(ctx context.Context, method, dataset string, do func() error) error {
+	fault := f.fault(method, dataset)
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if fault.Code == 0 {
+		return do()
+	}
+	if fault.Partial {
+		if err := do(); err != nil {
+			return err
+		}
+	}
+	return &googleapi.Error{
+		Code:    fault.Code,
+		Message: "injected " + http.StatusText(fault.Code),
+	}
+}
+
+// fault counts the call, and returns the first fault matching it, using it up.
+func (f *FaultyBigQuery) fault(method, dataset string) Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[method+"/"+dataset]++
+	for i, fault := range f.faults {
+		if (fault.Method != "" && fault.Method != method) || (fault.Dataset != "" && fault.Dataset != dataset) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+			}
+		}
+		return *fault
+	}
+	return Fault{}
+}
+
+func (f *FaultyBigQuery) stale(dataset string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pending[dataset] == 0 {
+		return false
+	}
+	f.pending[dataset]--
+	return true
+}
+
+func TestFaultyBigQuery(t *testing.T) {
+	ctx := context.Background()
+	server, bq := newFakeBigQuery(t)
+	faulty := NewFaultyBigQuery(bq)
+
+	faulty.Inject(Fault{Method: "Create", Dataset: "ds", Code: http.StatusServiceUnavailable, Partial: true, Times: 1})
+	faulty.Inject(Fault{Method: "Get", Code: http.StatusTooManyRequests, Times: 1})
+
+	if err := faulty.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "ds"}); errorCode(err) != "503" {
+		t.Errorf("expected injected 503, got %v", err)
+	}
+	if !server.HasDataset("proj", "ds") {
+		t.Error("expected partial fault to pass the call on")
+	}
+	if err := faulty.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "ds"}); errorCode(err) != "409" {
+		t.Errorf("expected 409 once the fault is used up, got %v", err)
+	}
+
+	if _, err := faulty.Get(ctx, "proj", "ds"); errorCode(err) != "429" {
+		t.Errorf("expected injected 429, got %v", err)
+	}
+	if _, err := faulty.Get(ctx, "proj", "ds"); err != nil {
+		t.Errorf("expected dataset, got %v", err)
+	}
+
+	if err := faulty.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	faulty.StaleReadsAfterCreate("new", 2)
+	if err := faulty.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if _, err := faulty.Get(ctx, "proj", "new"); errorCode(err) != "404" {
+			t.Errorf("read %d: expected stale 404, got %v", i, err)
+		}
+	}
+	if _, err := faulty.Get(ctx, "proj", "new"); err != nil {
+		t.Errorf("expected consistent read, got %v", err)
+	}
+
+	faulty.Inject(Fault{Dataset: "other", Latency: time.Second})
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := faulty.Get(timeout, "proj", "other"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected latency to respect the context, got %v", err)
+	}
+	faulty.Clear("other")
+	if _, err := faulty.Get(ctx, "proj", "other"); err != nil {
+		t.Errorf("expected faults to be cleared, got %v", err)
+	}
+
+	if got := faulty.Calls("Get", "new"); got != 3 {
+		t.Errorf("expected 3 calls to Get, got %d", got)
+	}
+}
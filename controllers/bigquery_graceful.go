@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// GracefulBigQuery lets Create, Update and Delete calls to the wrapped BigQuery
+// implementation finish for up to Timeout after their context is cancelled,
+// e.g. when the manager shuts down or hands over leadership. Cutting a write
+// off leaves it unknown whether BigQuery applied it. Writes aren't started
+// once the context is cancelled, and reads are cancelled right away.
+type GracefulBigQuery struct {
+	BigQuery BigQuery
+	Timeout  time.Duration
+}
+
+var _ BigQuery = &GracefulBigQuery{}
+
+func NewGracefulBigQuery(bq BigQuery, timeout time.Duration) *GracefulBigQuery {
+	return &GracefulBigQuery{
+		BigQuery: bq,
+		Timeout:  timeout,
+	}
+}
+
+func (g *GracefulBigQuery) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
+	return g.BigQuery.Get(ctx, projectID, name)
+}
+
+func (g *GracefulBigQuery) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
+	ctx, done, err := g.detach(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return g.BigQuery.Create(ctx, projectID, dataset)
+}
+
+func (g *GracefulBigQuery) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error {
+	ctx, done, err := g.detach(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return g.BigQuery.Update(ctx, projectID, name, dataset, etag)
+}
+
+func (g *GracefulBigQuery) Delete(ctx context.Context, projectID, name string) error {
+	ctx, done, err := g.detach(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return g.BigQuery.Delete(ctx, projectID, name)
+}
+
+func (g *GracefulBigQuery) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	return g.BigQuery.List(ctx, projectID, filter)
+}
+
+// detach returns a context with the values of ctx, that is cancelled Timeout
+// after ctx is, or when done is called. It returns the error of ctx if it is
+// already cancelled.
+func (g *GracefulBigQuery) detach(ctx context.Context) (_ context.Context, done func(), _ error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	detached, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			select {
+			case <-finished:
+			case <-time.After(g.Timeout):
+				cancel()
+			}
+		}
+	}()
+
+	return detached, func() {
+		close(finished)
+		cancel()
+	}, nil
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestGracefulBigQuery(t *testing.T) {
+	_, bq := newFakeBigQuery(t)
+	faulty := NewFaultyBigQuery(bq)
+	graceful := NewGracefulBigQuery(faulty, time.Second)
+
+	if err := bq.Create(context.Background(), "proj", &bigquery.DatasetMetadata{Name: "ds"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelDuring returns a context that is cancelled while a call with the
+	// injected latency is in flight.
+	cancelDuring := func() context.Context {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		return ctx
+	}
+
+	t.Run("in-flight write finishes", func(t *testing.T) {
+		faulty.Inject(Fault{Method: "Update", Dataset: "ds", Latency: 200 * time.Millisecond, Times: 1})
+		update := bigquery.DatasetMetadataToUpdate{Description: "finished"}
+		if err := graceful.Update(cancelDuring(), "proj", "ds", update, ""); err != nil {
+			t.Fatalf("expected update to finish, got %v", err)
+		}
+		md, err := bq.Get(context.Background(), "proj", "ds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Description != "finished" {
+			t.Errorf("expected update to be applied, got description %q", md.Description)
+		}
+	})
+
+	t.Run("in-flight write is cancelled after timeout", func(t *testing.T) {
+		graceful := NewGracefulBigQuery(faulty, 10*time.Millisecond)
+		faulty.Inject(Fault{Method: "Delete", Dataset: "ds", Latency: time.Minute, Times: 1})
+		if err := graceful.Delete(cancelDuring(), "proj", "ds"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected delete to be cancelled, got %v", err)
+		}
+	})
+
+	t.Run("write isn't started after cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := faulty.Calls("Delete", "ds")
+		if err := graceful.Delete(ctx, "proj", "ds"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context error, got %v", err)
+		}
+		if faulty.Calls("Delete", "ds") != calls {
+			t.Error("expected delete not to be passed on")
+		}
+	})
+
+	t.Run("read is cancelled", func(t *testing.T) {
+		faulty.Inject(Fault{Method: "Get", Dataset: "ds", Latency: time.Minute, Times: 1})
+		if _, err := graceful.Get(cancelDuring(), "proj", "ds"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected get to be cancelled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type namespaceContextKey struct{}
+
+// ContextWithNamespace returns a context carrying the namespace of the
+// BigQueryDataset being reconciled, for use by a ClientFactory.
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceContextKey{}, namespace)
+}
+
+// NamespaceFromContext returns the namespace set by ContextWithNamespace.
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	namespace, ok := ctx.Value(namespaceContextKey{}).(string)
+	return namespace, ok
+}
+
+// ImpersonatingClientFactory returns clients that impersonate the Google
+// service account given by Annotation on the namespace in the context. The
+// clients are kept in Clients, per service account and project.
+type ImpersonatingClientFactory struct {
+	Reader     client.Reader
+	Annotation string
+	Clients    *ClientPool
+	// Fallback is used for namespaces without the annotation. If nil, calls for
+	// such namespaces fail instead.
+	Fallback ClientFactory
+}
+
+var (
+	_ ClientFactory = &ImpersonatingClientFactory{}
+	_ Identifier    = &ImpersonatingClientFactory{}
+)
+
+func (f *ImpersonatingClientFactory) Client(ctx context.Context, projectID string) (*bigquery.Client, error) {
+	serviceAccount, err := f.serviceAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if serviceAccount == "" {
+		if f.Fallback == nil {
+			return nil, fmt.Errorf("no service account to impersonate, %s annotation is missing on the namespace", f.Annotation)
+		}
+		return f.Fallback.Client(ctx, projectID)
+	}
+	return f.Clients.ImpersonatingClient(ctx, serviceAccount, projectID)
+}
+
+// Identity returns the service account impersonated for the namespace in the
+// context, or else the identity of Fallback.
+func (f *ImpersonatingClientFactory) Identity(ctx context.Context) (string, error) {
+	serviceAccount, err := f.serviceAccount(ctx)
+	if err != nil || serviceAccount != "" {
+		return serviceAccount, err
+	}
+	if identifier, ok := f.Fallback.(Identifier); ok {
+		return identifier.Identity(ctx)
+	}
+	return "", nil
+}
+
+// serviceAccount returns the service account annotated on the namespace in the
+// context, or "" if there is none.
+func (f *ImpersonatingClientFactory) serviceAccount(ctx context.Context) (string, error) {
+	namespace, ok := NamespaceFromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := f.Reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return "", err
+	}
+	return ns.GetAnnotations()[f.Annotation], nil
+}
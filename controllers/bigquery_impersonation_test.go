@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestImpersonatingClientFactory(t *testing.T) {
+	ctx := context.Background()
+
+	fallback := &ClientPool{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})}
+	fallbackClient, err := fallback.Client(ctx, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+		namespaceWithServiceAccount("annotated", "team@project.iam.gserviceaccount.com"),
+	).Build()
+
+	t.Run("namespace is carried in context", func(t *testing.T) {
+		if _, ok := NamespaceFromContext(ctx); ok {
+			t.Error("expected no namespace in empty context")
+		}
+		namespace, ok := NamespaceFromContext(ContextWithNamespace(ctx, "team"))
+		if !ok || namespace != "team" {
+			t.Errorf("expected namespace %q, got %q", "team", namespace)
+		}
+	})
+
+	t.Run("fails without annotation and fallback", func(t *testing.T) {
+		factory := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation}
+		if _, err := factory.Client(ContextWithNamespace(ctx, "plain"), "proj"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("uses fallback without annotation", func(t *testing.T) {
+		factory := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation, Fallback: fallback}
+		got, err := factory.Client(ContextWithNamespace(ctx, "plain"), "proj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != fallbackClient {
+			t.Error("expected fallback client")
+		}
+	})
+
+	t.Run("impersonates annotated service account", func(t *testing.T) {
+		pool := &ClientPool{Impersonate: func(serviceAccount string) (oauth2.TokenSource, error) {
+			return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: serviceAccount}), nil
+		}}
+		factory := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation, Clients: pool, Fallback: fallback}
+		got, err := factory.Client(ContextWithNamespace(ctx, "annotated"), "proj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == fallbackClient {
+			t.Error("expected impersonating client")
+		}
+		if _, ok := pool.tokenSources["team@project.iam.gserviceaccount.com"]; !ok {
+			t.Error("expected client to be pooled for the service account")
+		}
+	})
+
+	t.Run("identity is the impersonated service account or the fallback's", func(t *testing.T) {
+		factory := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation, Fallback: &ClientPool{Email: "bqrator@example.com"}}
+		for namespace, expected := range map[string]string{
+			"annotated": "team@project.iam.gserviceaccount.com",
+			"plain":     "bqrator@example.com",
+		} {
+			identity, err := factory.Identity(ContextWithNamespace(ctx, namespace))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity != expected {
+				t.Errorf("expected identity %q in %s, got %q", expected, namespace, identity)
+			}
+		}
+	})
+
+	t.Run("fails for unknown namespace", func(t *testing.T) {
+		factory := &ImpersonatingClientFactory{Reader: c, Annotation: impersonationAnnotation, Fallback: fallback}
+		if _, err := factory.Client(ContextWithNamespace(ctx, "missing"), "proj"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+const impersonationAnnotation = "bqrator.nais.io/service-account"
+
+func namespaceWithServiceAccount(name, serviceAccount string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Annotations: map[string]string{impersonationAnnotation: serviceAccount},
+	}}
+}
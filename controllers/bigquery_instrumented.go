@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// InstrumentedBigQuery records the number, latency and errors of calls to the
+// wrapped BigQuery implementation, traces them, and logs each call at debug
+// level.
+type InstrumentedBigQuery struct {
+	BigQuery BigQuery
+}
+
+var _ BigQuery = &InstrumentedBigQuery{}
+
+func NewInstrumentedBigQuery(bq BigQuery) *InstrumentedBigQuery {
+	return &InstrumentedBigQuery{BigQuery: bq}
+}
+
+func (i *InstrumentedBigQuery) Get(ctx context.Context, projectID, name string) (_ *bigquery.DatasetMetadata, err error) {
+	ctx, span := startCallSpan(ctx, "Get", projectID, name)
+	defer func() { endSpan(span, err) }()
+	defer observeCall(ctx, "get", projectID, name, time.Now(), &err)
+	return i.BigQuery.Get(ctx, projectID, name)
+}
+
+func (i *InstrumentedBigQuery) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) (err error) {
+	ctx, span := startCallSpan(ctx, "Create", projectID, dataset.Name)
+	defer func() { endSpan(span, err) }()
+	defer observeCall(ctx, "create", projectID, dataset.Name, time.Now(), &err)
+	return i.BigQuery.Create(ctx, projectID, dataset)
+}
+
+func (i *InstrumentedBigQuery) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) (err error) {
+	ctx, span := startCallSpan(ctx, "Update", projectID, name)
+	defer func() { endSpan(span, err) }()
+	defer observeCall(ctx, "update", projectID, name, time.Now(), &err)
+	return i.BigQuery.Update(ctx, projectID, name, dataset, etag)
+}
+
+func (i *InstrumentedBigQuery) Delete(ctx context.Context, projectID, name string) (err error) {
+	ctx, span := startCallSpan(ctx, "Delete", projectID, name)
+	defer func() { endSpan(span, err) }()
+	defer observeCall(ctx, "delete", projectID, name, time.Now(), &err)
+	return i.BigQuery.Delete(ctx, projectID, name)
+}
+
+func (i *InstrumentedBigQuery) List(ctx context.Context, projectID, filter string) (_ []string, err error) {
+	ctx, span := startCallSpan(ctx, "List", projectID, "")
+	defer func() { endSpan(span, err) }()
+	defer observeCall(ctx, "list", projectID, "", time.Now(), &err)
+	return i.BigQuery.List(ctx, projectID, filter)
+}
+
+// startCallSpan starts a span for a call to the BigQuery method.
+func startCallSpan(ctx context.Context, method, projectID, name string) (context.Context, trace.Span) {
+	team, _ := NamespaceFromContext(ctx)
+	return tracer.Start(ctx, "BigQuery."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("gcp.project_id", projectID),
+		attribute.String("bqrator.bigquery.dataset", name),
+		attribute.String("bqrator.team", team),
+	))
+}
+
+// observeCall records a BigQuery call started at start. It is meant to be
+// deferred with a pointer to the named error result.
+func observeCall(ctx context.Context, method, projectID, name string, start time.Time, err *error) {
+	duration := time.Since(start)
+	metrics.BigQueryCalls.WithLabelValues(method).Inc()
+	metrics.BigQueryCallDuration.WithLabelValues(method).Observe(duration.Seconds())
+
+	log := log.FromContext(ctx).V(1).WithValues("method", method, "project", projectID, "dataset", name, "duration", duration)
+	if *err != nil {
+		metrics.BigQueryErrors.WithLabelValues(method, errorCode(*err)).Inc()
+		log.Info("BigQuery call failed", "error", (*err).Error())
+		return
+	}
+	log.Info("BigQuery call succeeded")
+}
+
+// errorCode returns the HTTP status code of a BigQuery API error, or "unknown".
+func errorCode(err error) string {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return strconv.Itoa(gerr.Code)
+	}
+	return "unknown"
+}
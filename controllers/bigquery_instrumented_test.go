@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/nais/bqrator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/api/googleapi"
+)
+
+func TestInstrumentedBigQuery(t *testing.T) {
+	ctx := context.Background()
+	server, bq := newFakeBigQuery(t)
+	instrumented := NewInstrumentedBigQuery(bq)
+
+	calls := testutil.ToFloat64(metrics.BigQueryCalls.WithLabelValues("get"))
+	errs := testutil.ToFloat64(metrics.BigQueryErrors.WithLabelValues("get", "404"))
+
+	if err := instrumented.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: "instrumented"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instrumented.Get(ctx, "proj", "instrumented"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instrumented.Get(ctx, "proj", "missing"); err == nil {
+		t.Fatal("expected error for missing dataset")
+	}
+
+	if got := testutil.ToFloat64(metrics.BigQueryCalls.WithLabelValues("get")) - calls; got != 2 {
+		t.Errorf("expected 2 get calls to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.BigQueryErrors.WithLabelValues("get", "404")) - errs; got != 1 {
+		t.Errorf("expected 1 get error to be counted, got %v", got)
+	}
+	if !server.HasDataset("proj", "instrumented") {
+		t.Error("expected create to be passed through")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &googleapi.Error{Code: 404}, want: "404"},
+		{err: fmt.Errorf("updating: %w", &googleapi.Error{Code: 412}), want: "412"},
+		{err: errors.New("dial tcp: i/o timeout"), want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v): expected %q, got %q", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestInstrumentedBigQueryTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	_, bq := newFakeBigQuery(t)
+	instrumented := NewInstrumentedBigQuery(bq)
+
+	ctx := ContextWithNamespace(context.Background(), "team")
+	if _, err := instrumented.Get(ctx, "proj", "missing"); err == nil {
+		t.Fatal("expected error for missing dataset")
+	}
+
+	// The client library records spans of its own
+	i := slices.IndexFunc(recorder.Ended(), func(s sdktrace.ReadOnlySpan) bool { return s.Name() == "BigQuery.Get" })
+	if i < 0 {
+		t.Fatal("expected a BigQuery.Get span")
+	}
+	span := recorder.Ended()[i]
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected error status, got %v", span.Status().Code)
+	}
+
+	attributes := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value.AsString()
+	}
+	want := map[attribute.Key]string{
+		"gcp.project_id":           "proj",
+		"bqrator.bigquery.dataset": "missing",
+		"bqrator.team":             "team",
+	}
+	if diff := cmp.Diff(want, attributes); diff != "" {
+		t.Errorf("unexpected attributes (-want +got):\n%s", diff)
+	}
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"context"
+	"errors"
 
 	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
 )
 
 type BigQuery interface {
@@ -11,27 +13,89 @@ type BigQuery interface {
 	Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error
 	Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error
 	Delete(ctx context.Context, projectID, name string) error
+	// List returns the IDs of the datasets in the project matching filter, which
+	// uses the syntax of the BigQuery API, such as "labels.team:myteam". An
+	// empty filter matches all datasets.
+	List(ctx context.Context, projectID, filter string) ([]string, error)
 }
 
+// ClientFactory returns the BigQuery client to use for a call against projectID.
+type ClientFactory interface {
+	Client(ctx context.Context, projectID string) (*bigquery.Client, error)
+}
+
+// Identifier is implemented by ClientFactories that know the identity their
+// clients for ctx make BigQuery calls as.
+type Identifier interface {
+	Identity(ctx context.Context) (string, error)
+}
+
+// BigQueryWrapper implements BigQuery using Client, or a client from Clients
+// when it is set.
 type BigQueryWrapper struct {
-	Client *bigquery.Client
+	Client  *bigquery.Client
+	Clients ClientFactory
 }
 
 var _ BigQuery = &BigQueryWrapper{}
 
 func (b *BigQueryWrapper) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
-	return b.Client.DatasetInProject(projectID, name).Metadata(ctx)
+	client, err := b.client(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return client.DatasetInProject(projectID, name).Metadata(ctx)
 }
 
 func (b *BigQueryWrapper) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
-	return b.Client.DatasetInProject(projectID, dataset.Name).Create(ctx, dataset)
+	client, err := b.client(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	return client.DatasetInProject(projectID, dataset.Name).Create(ctx, dataset)
 }
 
 func (b *BigQueryWrapper) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error {
-	_, err := b.Client.DatasetInProject(projectID, name).Update(ctx, dataset, etag)
+	client, err := b.client(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	_, err = client.DatasetInProject(projectID, name).Update(ctx, dataset, etag)
 	return err
 }
 
 func (b *BigQueryWrapper) Delete(ctx context.Context, projectID, name string) error {
-	return b.Client.DatasetInProject(projectID, name).Delete(ctx)
+	client, err := b.client(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	return client.DatasetInProject(projectID, name).Delete(ctx)
+}
+
+func (b *BigQueryWrapper) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	client, err := b.client(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	it := client.DatasetsInProject(ctx, projectID)
+	it.Filter = filter
+	var names []string
+	for {
+		dataset, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, dataset.DatasetID)
+	}
+}
+
+func (b *BigQueryWrapper) client(ctx context.Context, projectID string) (*bigquery.Client, error) {
+	if b.Clients != nil {
+		return b.Clients.Client(ctx, projectID)
+	}
+	return b.Client, nil
 }
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestBigQueryWrapperList(t *testing.T) {
+	ctx := context.Background()
+	_, bq := newFakeBigQuery(t)
+
+	for name, team := range map[string]string{"a": "x", "b": "y", "c": "x"} {
+		if err := bq.Create(ctx, "proj", &bigquery.DatasetMetadata{Name: name, Labels: map[string]string{"team": team}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := bq.List(ctx, "proj", "labels.team:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("expected datasets a and c, got %v", names)
+	}
+
+	names, err = bq.List(ctx, "proj", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Errorf("expected all datasets, got %v", names)
+	}
+}
@@ -19,58 +19,177 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"os"
+	"hash/fnv"
 	"slices"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/config"
 	"github.com/nais/bqrator/pkg/metrics"
 	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/googleapi"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-const finalizer = "bqrator.nais.io/finalizer"
+const (
+	finalizer = "bqrator.nais.io/finalizer"
+
+	// pausedAnnotation can be set to "true" on a BigQueryDataset or its Namespace
+	// to stop bqrator from making any changes in BigQuery.
+	pausedAnnotation = "bqrator.nais.io/paused"
+
+	// resyncAnnotation forces a full synchronization with BigQuery whenever its
+	// value changes, even if the spec is unchanged.
+	resyncAnnotation = "bqrator.nais.io/resync-at"
+
+	// projectAnnotation records the GCP project the dataset was synchronized to,
+	// so that a change of the namespace's project can be detected.
+	projectAnnotation = "bqrator.nais.io/project-id"
+
+	// namespaceProjectLabel and namespaceProjectAnnotation are where NAIS stores
+	// the GCP project of a namespace.
+	namespaceProjectLabel      = "google-cloud-project"
+	namespaceProjectAnnotation = "cnrm.cloud.google.com/project-id"
+
+	maxConditionMessageLength = 32768
+	maxEventNoteLength        = 1024
+)
+
+// Outcomes of a reconcile, as counted by metrics.BigQueryDatasetOutcomes.
+const (
+	outcomeCreate   = "create"
+	outcomeUpdate   = "update"
+	outcomeNoop     = "noop"
+	outcomeDelete   = "delete"
+	outcomeRecreate = "recreate"
+)
 
 // BigQueryDatasetReconciler reconciles a BigQueryDataset object
 type BigQueryDatasetReconciler struct {
 	client.Client
-	Scheme         *runtime.Scheme
-	bigqueryClient BigQuery
+	Scheme          *runtime.Scheme
+	config          config.Config
+	bigqueryClient  BigQuery
+	projectResolver ProjectResolver
+	dryRun          *DryRunBigQuery
+	recorder        events.EventRecorder
+	auditSink       AuditSink
+	identity        Identifier
+	shard           Shard
+}
+
+// Option configures optional behaviour of the BigQueryDatasetReconciler.
+type Option func(*BigQueryDatasetReconciler)
+
+// WithDryRun makes the reconciler leave finalizers and the synchronization
+// state alone, and instead report the actions recorded by dryRun in the
+// "DryRun" status condition. Finalizers are only removed from deleted
+// resources, which would otherwise never go away, after logging the planned
+// delete.
+func WithDryRun(dryRun *DryRunBigQuery) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.dryRun = dryRun
+	}
+}
+
+// WithAuditSink replaces the default audit sink, which logs the audit records
+// with the "audit" logger.
+func WithAuditSink(sink AuditSink) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.auditSink = sink
+	}
+}
+
+// WithIdentity makes the audit records name the identity given by identity
+// as operator, instead of the configured owner email. This is needed when
+// BigQuery calls are made as different identities, such as when impersonating.
+func WithIdentity(identity Identifier) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.identity = identity
+	}
+}
+
+// WithConfig replaces the default configuration, config.Default().
+func WithConfig(cfg config.Config) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.config = cfg
+	}
+}
+
+// WithProjectResolver replaces the default NamespaceProjectResolver, which
+// reads the project from the NAIS namespace label and annotation.
+func WithProjectResolver(resolver ProjectResolver) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.projectResolver = resolver
+	}
+}
+
+// WithShard makes the reconciler leave BigQueryDatasets in namespaces outside
+// the shard alone, for another instance of bqrator to reconcile.
+func WithShard(shard Shard) Option {
+	return func(r *BigQueryDatasetReconciler) {
+		r.shard = shard
+	}
 }
 
-func NewBigQueryDatasetReconciler(client client.Client, scheme *runtime.Scheme, bqClient BigQuery) *BigQueryDatasetReconciler {
-	return &BigQueryDatasetReconciler{
-		bigqueryClient: bqClient,
-		Client:         client,
-		Scheme:         scheme,
+func NewBigQueryDatasetReconciler(client client.Client, scheme *runtime.Scheme, bqClient BigQuery, opts ...Option) *BigQueryDatasetReconciler {
+	r := &BigQueryDatasetReconciler{
+		config:          config.Default(),
+		bigqueryClient:  bqClient,
+		projectResolver: NewNamespaceProjectResolver(client),
+		auditSink:       &LogAuditSink{Log: ctrl.Log.WithName("audit")},
+		Client:          client,
+		Scheme:          scheme,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *BigQueryDatasetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.recorder == nil {
+		r.recorder = mgr.GetEventRecorder("bqrator")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&google_nais_io_v1.BigQueryDataset{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+			RateLimiter:             newRequeueRateLimiter(r.config.RateLimit),
+		}).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.datasetsInNamespace),
+			builder.WithPredicates(namespaceChanged(r.projectResolver)),
+		).
 		Complete(r)
 }
 
 //+kubebuilder:rbac:groups=google.nais.io,resources=bigquerydatasets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=google.nais.io,resources=bigquerydatasets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=google.nais.io,resources=bigquerydatasets/finalizers,verbs=update
-//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-func (r *BigQueryDatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BigQueryDatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
 	log := log.FromContext(ctx)
 
 	var dataset google_nais_io_v1.BigQueryDataset
@@ -81,8 +200,41 @@ func (r *BigQueryDatasetReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	inShard, err := r.shard.inShard(ctx, r.Client, dataset)
+	if err != nil {
+		log.Error(err, "unable to fetch namespace")
+		return ctrl.Result{}, err
+	}
+	if !inShard {
+		log.V(1).Info("Namespace is outside of shard, skipping")
+		return ctrl.Result{}, nil
+	}
+
+	ctx, span := startSpan(ctx, "Reconcile", dataset)
+	defer func() { endSpan(span, err) }()
+
 	log.Info("Reconciling BigQueryDataset", "name", dataset.Name)
 	metrics.BigQueryDatasetProcessed.Inc()
+	defer func(start time.Time) {
+		metrics.ReconcileDuration.WithLabelValues(dataset.Namespace).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	ctx = ContextWithNamespace(ctx, dataset.Namespace)
+
+	paused, err := r.isPaused(ctx, dataset)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		return ctrl.Result{}, r.onPaused(ctx, dataset)
+	}
+
+	if meta.RemoveStatusCondition(&dataset.Status.Conditions, "Paused") {
+		if err := r.updateStatus(ctx, &dataset); err != nil {
+			log.Error(err, "unable to remove paused condition")
+			return ctrl.Result{}, err
+		}
+	}
 
 	if !dataset.DeletionTimestamp.IsZero() {
 		return r.onDelete(ctx, dataset)
@@ -91,59 +243,194 @@ func (r *BigQueryDatasetReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	if err := r.createOrUpdate(ctx, dataset); err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.config.ResyncInterval.Duration}, nil
+}
+
+// isPaused reports whether reconciliation is paused for the dataset, either
+// directly on the resource or on the namespace it lives in.
+func (r *BigQueryDatasetReconciler) isPaused(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (bool, error) {
+	if dataset.GetAnnotations()[pausedAnnotation] == "true" {
+		return true, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: dataset.Namespace}, ns); err != nil {
+		return false, err
+	}
+	return ns.GetAnnotations()[pausedAnnotation] == "true", nil
 }
 
-func (r *BigQueryDatasetReconciler) createOrUpdate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) error {
+// onPaused marks the dataset as paused without touching BigQuery. Finalizers are
+// left in place, so a paused dataset that is deleted stays around until it is
+// unpaused.
+func (r *BigQueryDatasetReconciler) onPaused(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) error {
 	log := log.FromContext(ctx)
-	currentHash, err := dataset.Hash()
+	log.Info("Reconciliation is paused, skipping")
+
+	changed := meta.SetStatusCondition(&dataset.Status.Conditions, metav1.Condition{
+		Type:               "Paused",
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Time(metav1.NowMicro()),
+		Reason:             "PausedByAnnotation",
+		Message:            "Reconciliation is paused by the " + pausedAnnotation + " annotation",
+	})
+	if !changed {
+		return nil
+	}
+
+	if err := r.updateStatus(ctx, &dataset); err != nil {
+		log.Error(err, "unable to update status")
+		return err
+	}
+	return nil
+}
+
+func (r *BigQueryDatasetReconciler) createOrUpdate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (err error) {
+	ctx, span := startSpan(ctx, "createOrUpdate", dataset)
+	defer func() { endSpan(span, err) }()
+
+	log := log.FromContext(ctx)
+	currentHash, err := synchronizationHash(dataset)
 	if err != nil {
 		log.Error(err, "unable to compute hash")
 		return err
 	}
 
-	if !slices.Contains(dataset.Finalizers, finalizer) {
+	gcpProjectID, err := r.resolveProject(ctx, dataset)
+	if err != nil {
+		log.Error(err, "unable to resolve GCP project")
+		return err
+	}
+
+	if recorded, ok := dataset.GetAnnotations()[projectAnnotation]; ok && recorded != gcpProjectID {
+		return r.onProjectChanged(ctx, dataset, recorded, gcpProjectID)
+	}
+
+	if r.dryRun == nil && (!slices.Contains(dataset.Finalizers, finalizer) || !metav1.HasAnnotation(dataset.ObjectMeta, projectAnnotation)) {
 		controllerutil.AddFinalizer(&dataset, finalizer)
+		metav1.SetMetaDataAnnotation(&dataset.ObjectMeta, projectAnnotation, gcpProjectID)
 		if err := r.Update(ctx, &dataset); err != nil {
 			log.Error(err, "unable to add finalizer")
 			return err
 		}
 	}
 
-	gcpProjectID, err := r.getProjectIDFromNamespace(ctx, dataset.Namespace)
-	if err != nil {
-		return err
-	}
-
 	dataset.Spec.Project = gcpProjectID
 
 	if dataset.Status.CreationTime == 0 {
-		return r.onCreate(ctx, dataset, currentHash)
-	} else if currentHash != dataset.Status.SynchronizationHash {
+		if len(r.config.AllowedLocations) > 0 && !slices.Contains(r.config.AllowedLocations, dataset.Spec.Location) {
+			return r.onLocationNotAllowed(ctx, dataset)
+		}
+		return r.onCreate(ctx, dataset, currentHash, outcomeCreate)
+	} else if currentHash != dataset.Status.SynchronizationHash || !meta.IsStatusConditionTrue(dataset.Status.Conditions, "Ready") || r.resyncDue(dataset) {
 		return r.onUpdate(ctx, dataset, currentHash)
 	}
 
 	return nil
 }
 
-func (r *BigQueryDatasetReconciler) getProjectIDFromNamespace(ctx context.Context, namespace string) (string, error) {
-	ns := &corev1.Namespace{}
-	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+// resolveProject resolves the GCP project of the dataset with the project
+// resolver.
+func (r *BigQueryDatasetReconciler) resolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (_ string, err error) {
+	ctx, span := startSpan(ctx, "ResolveProject", dataset)
+	defer func() { endSpan(span, err) }()
+
+	projectID, err := r.projectResolver.ResolveProject(ctx, dataset)
+	if err != nil {
+		return "", err
+	}
+	span.SetAttributes(attribute.String("gcp.project_id", projectID))
+	return projectID, nil
+}
+
+// resyncDue reports whether the dataset hasn't been compared with BigQuery for
+// longer than the resync interval.
+func (r *BigQueryDatasetReconciler) resyncDue(dataset google_nais_io_v1.BigQueryDataset) bool {
+	if r.config.ResyncInterval.Duration == 0 {
+		return false
+	}
+	lastModified := time.Unix(int64(dataset.Status.LastModifiedTime), 0)
+	return time.Since(lastModified) >= r.config.ResyncInterval.Duration
+}
+
+// onLocationNotAllowed flags a dataset that can't be created because its
+// location isn't one of the allowed locations.
+func (r *BigQueryDatasetReconciler) onLocationNotAllowed(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) error {
+	log := log.FromContext(ctx)
+	log.Info("Location is not allowed, skipping", "location", dataset.Spec.Location)
+
+	message := fmt.Sprintf("Location %q is not allowed, must be one of %v", dataset.Spec.Location, r.config.AllowedLocations)
+	changed := meta.SetStatusCondition(&dataset.Status.Conditions, metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Time(metav1.NowMicro()),
+		Reason:             "LocationNotAllowed",
+		Message:            message,
+	})
+	if !changed {
+		return nil
+	}
+
+	r.event(&dataset, corev1.EventTypeWarning, "LocationNotAllowed", "Create", message)
+	if err := r.updateStatus(ctx, &dataset); err != nil {
+		log.Error(err, "unable to update status")
+		return err
+	}
+	return nil
+}
+
+// synchronizationHash returns the hash stored in Status.SynchronizationHash. When
+// the resync annotation is set its value is mixed into the spec hash, so that
+// changing the annotation invalidates the stored hash and triggers onUpdate.
+func synchronizationHash(dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	hash, err := dataset.Hash()
+	if err != nil {
 		return "", err
 	}
 
-	projectID, ok := ns.Labels["google-cloud-project"]
+	resyncAt, ok := dataset.GetAnnotations()[resyncAnnotation]
 	if !ok {
-		projectID, ok = ns.Annotations["cnrm.cloud.google.com/project-id"]
-		if !ok {
-			return "", fmt.Errorf("both google-cloud-project and cnrm.cloud.google.com/project-id is missing, can't find GCP project id")
-		}
+		return hash, nil
 	}
 
-	return projectID, nil
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(hash + "/" + resyncAt))
+	return fmt.Sprintf("%x", h.Sum64()), nil
 }
 
-func (r *BigQueryDatasetReconciler) onUpdate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, hash string) error {
+// onProjectChanged flags a dataset whose namespace now resolves to a different
+// GCP project than the one the dataset was synchronized to. Nothing is done in
+// BigQuery until the namespace is changed back, or the BigQueryDataset is
+// deleted and recreated.
+func (r *BigQueryDatasetReconciler) onProjectChanged(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, recorded, resolved string) error {
+	log := log.FromContext(ctx)
+	log.Info("GCP project for namespace has changed, skipping", "recordedProject", recorded, "project", resolved)
+
+	message := fmt.Sprintf("The namespace now belongs to GCP project %q, but the dataset is in project %q. "+
+		"Change the namespace back, or delete and recreate the BigQueryDataset.", resolved, recorded)
+	changed := meta.SetStatusCondition(&dataset.Status.Conditions, metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Time(metav1.NowMicro()),
+		Reason:             "ProjectChanged",
+		Message:            message,
+	})
+	if !changed {
+		return nil
+	}
+
+	r.event(&dataset, corev1.EventTypeWarning, "ProjectChanged", "Reconcile", message)
+	if err := r.updateStatus(ctx, &dataset); err != nil {
+		log.Error(err, "unable to update status")
+		return err
+	}
+	return nil
+}
+
+func (r *BigQueryDatasetReconciler) onUpdate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, hash string) (err error) {
+	ctx, span := startSpan(ctx, "onUpdate", dataset)
+	defer func() { endSpan(span, err) }()
+
 	log := log.FromContext(ctx)
 
 	existing, err := r.bigqueryClient.Get(ctx, dataset.Spec.Project, dataset.Spec.Name)
@@ -151,29 +438,13 @@ func (r *BigQueryDatasetReconciler) onUpdate(ctx context.Context, dataset google
 		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 404 {
 			log.Info("Dataset not found in GCP, recreating")
 			dataset.Status.CreationTime = 0
-			return r.onCreate(ctx, dataset, hash)
+			return r.onCreate(ctx, dataset, hash, outcomeRecreate)
 		}
 		log.Error(err, "Unable to fetch existing dataset")
 		return err
 	}
 
-	access := createAccessList(dataset)
-	existingAccess := removeDeletedServiceAccounts(existing.Access)
-	for _, existingMember := range existingAccess {
-		found := false
-		for _, member := range access {
-			// Entity will be empty string for view access, so we only compare on entity if it's not empty
-			if existingMember.Entity == member.Entity && member.Entity != "" {
-				found = true
-				break
-			}
-		}
-		if !found {
-			access = append(access, existingMember)
-		}
-	}
-
-	access = ensureBQratorOwner(access)
+	access := mergeAccess(createAccessList(dataset), existing.Access, r.config.OwnerEmail)
 
 	metadata := bigquery.DatasetMetadataToUpdate{
 		Name:        dataset.Spec.Name,
@@ -181,20 +452,40 @@ func (r *BigQueryDatasetReconciler) onUpdate(ctx context.Context, dataset google
 		Access:      access,
 	}
 
-	if metav1.HasLabel(dataset.ObjectMeta, "app") {
-		metadata.SetLabel("app", dataset.GetLabels()["app"])
+	for key, value := range datasetLabels(dataset) {
+		metadata.SetLabel(key, value)
+	}
+
+	diff := diffDataset(dataset, existing, access)
+	diffCondition := metav1.Condition{
+		Type:               "Diff",
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Time(metav1.NowMicro()),
+		Reason:             "NoChanges",
+		Message:            truncate(diff.String(), maxConditionMessageLength),
 	}
-	metadata.SetLabel("team", dataset.GetNamespace())
 
 	if metadataEqual(dataset, existing, access) {
 		log.Info("No-op update detected, skipping GCP update call")
+		r.recordOutcome(dataset, outcomeNoop)
 	} else {
+		log.Info("Updating dataset", "diff", diff.String())
 		err = r.bigqueryClient.Update(ctx, dataset.Spec.Project, dataset.Spec.Name, metadata, existing.ETag)
 		if err != nil {
 			log.Error(err, "unable to update dataset")
 			return err
 		}
+		r.recordOutcome(dataset, outcomeUpdate)
+		r.audit(ctx, dataset, diff)
+
+		diffCondition.Status = metav1.ConditionTrue
+		diffCondition.Reason = "ChangesApplied"
+		if r.dryRun != nil {
+			diffCondition.Reason = "ChangesPlanned"
+		}
+		r.event(&dataset, corev1.EventTypeNormal, diffCondition.Reason, "Update", diff.String())
 	}
+	meta.SetStatusCondition(&dataset.Status.Conditions, diffCondition)
 
 	dataset.Status.LastModifiedTime = int(time.Now().Unix())
 	meta.SetStatusCondition(&dataset.Status.Conditions, metav1.Condition{
@@ -206,7 +497,7 @@ func (r *BigQueryDatasetReconciler) onUpdate(ctx context.Context, dataset google
 	})
 	dataset.Status.SynchronizationHash = hash
 
-	if err := r.Status().Update(ctx, &dataset); err != nil {
+	if err := r.updateStatus(ctx, &dataset); err != nil {
 		log.Error(err, "unable to update status")
 		return err
 	}
@@ -237,50 +528,75 @@ func metadataEqual(dataset google_nais_io_v1.BigQueryDataset, existing *bigquery
 	return true
 }
 
-// accessSubEntity returns a string that uniquely identifies the sub-entity of
-// an AccessEntry for ViewEntity, RoutineEntity, and DatasetEntity types, whose
-// Entity field is always empty. Returns "" for standard entity types.
-func accessSubEntity(e *bigquery.AccessEntry) string {
+// accessSubEntity identifies the view, routine or dataset of an AccessEntry for
+// ViewEntity, RoutineEntity, and DatasetEntity types, whose Entity field is
+// always empty. It is the zero value for standard entity types.
+type accessSubEntity struct {
+	ProjectID string
+	DatasetID string
+	ID        string
+	// TargetTypes are sorted and quoted, so that neither their order nor their
+	// content can make two different lists look the same.
+	TargetTypes string
+}
+
+func accessSubEntityOf(e *bigquery.AccessEntry) accessSubEntity {
 	if e.View != nil {
-		return fmt.Sprintf("%s/%s/%s", e.View.ProjectID, e.View.DatasetID, e.View.TableID)
+		return accessSubEntity{ProjectID: e.View.ProjectID, DatasetID: e.View.DatasetID, ID: e.View.TableID}
 	}
 	if e.Routine != nil {
-		return fmt.Sprintf("%s/%s/%s", e.Routine.ProjectID, e.Routine.DatasetID, e.Routine.RoutineID)
+		return accessSubEntity{ProjectID: e.Routine.ProjectID, DatasetID: e.Routine.DatasetID, ID: e.Routine.RoutineID}
 	}
 	if e.Dataset != nil && e.Dataset.Dataset != nil {
 		types := slices.Clone(e.Dataset.TargetTypes)
 		slices.Sort(types)
-		return fmt.Sprintf("%s/%s/%s", e.Dataset.Dataset.ProjectID, e.Dataset.Dataset.DatasetID, strings.Join(types, ","))
+		return accessSubEntity{
+			ProjectID:   e.Dataset.Dataset.ProjectID,
+			DatasetID:   e.Dataset.Dataset.DatasetID,
+			TargetTypes: fmt.Sprintf("%q", types),
+		}
 	}
-	return ""
+	return accessSubEntity{}
 }
 
-// accessSetEqual reports whether a and b contain the same access entries,
-// regardless of order. Entries are compared by Role, EntityType, Entity, and
+// accessEntryKey identifies an access entry by Role, EntityType, Entity, and
 // SubEntity (for View, Routine, and Dataset grants where Entity is always "").
+type accessEntryKey struct {
+	Role       bigquery.AccessRole
+	EntityType bigquery.EntityType
+	Entity     string
+	SubEntity  accessSubEntity
+}
+
+func keyOf(e *bigquery.AccessEntry) accessEntryKey {
+	return accessEntryKey{e.Role, e.EntityType, e.Entity, accessSubEntityOf(e)}
+}
+
+// accessSetEqual reports whether a and b contain the same access entries,
+// regardless of order. Entries are compared by their accessEntryKey, and
+// duplicates are counted, so that [x, x] and [x, y] are not equal either way.
 func accessSetEqual(a, b []*bigquery.AccessEntry) bool {
 	if len(a) != len(b) {
 		return false
 	}
-	type key struct {
-		Role       bigquery.AccessRole
-		EntityType bigquery.EntityType
-		Entity     string
-		SubEntity  string
-	}
-	set := make(map[key]struct{}, len(a))
+	counts := make(map[accessEntryKey]int, len(a))
 	for _, entry := range a {
-		set[key{entry.Role, entry.EntityType, entry.Entity, accessSubEntity(entry)}] = struct{}{}
+		counts[keyOf(entry)]++
 	}
 	for _, entry := range b {
-		if _, ok := set[key{entry.Role, entry.EntityType, entry.Entity, accessSubEntity(entry)}]; !ok {
+		key := keyOf(entry)
+		if counts[key] == 0 {
 			return false
 		}
+		counts[key]--
 	}
 	return true
 }
 
-func (r *BigQueryDatasetReconciler) onDelete(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (ctrl.Result, error) {
+func (r *BigQueryDatasetReconciler) onDelete(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (_ ctrl.Result, err error) {
+	ctx, span := startSpan(ctx, "onDelete", dataset)
+	defer func() { endSpan(span, err) }()
+
 	log := log.FromContext(ctx).WithValues("name", dataset.Name)
 
 	if !slices.Contains(dataset.Finalizers, finalizer) {
@@ -292,13 +608,23 @@ func (r *BigQueryDatasetReconciler) onDelete(ctx context.Context, dataset google
 		return ctrl.Result{}, nil
 	}
 
-	gcpProject, err := r.getProjectIDFromNamespace(ctx, dataset.Namespace)
-	if err != nil {
-		return ctrl.Result{}, err
+	gcpProject, ok := dataset.GetAnnotations()[projectAnnotation]
+	if !ok {
+		gcpProject, err = r.resolveProject(ctx, dataset)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	log.Info("Deleting BigQueryDataset")
 	if dataset.Spec.CascadingDelete {
+		// The access entries are read before deleting the dataset, so that
+		// their removal can be audited.
+		access := createAccessList(dataset)
+		if existing, err := r.bigqueryClient.Get(ctx, gcpProject, dataset.Spec.Name); err == nil {
+			access = existing.Access
+		}
+
 		if err := r.bigqueryClient.Delete(ctx, gcpProject, dataset.Spec.Name); err != nil {
 			meta.SetStatusCondition(&dataset.Status.Conditions, metav1.Condition{
 				Type:               "Ready",
@@ -308,17 +634,31 @@ func (r *BigQueryDatasetReconciler) onDelete(ctx context.Context, dataset google
 				Message:            "Unable to delete from Google: " + err.Error(),
 			})
 
-			if err := r.Status().Update(ctx, &dataset); err != nil {
+			if err := r.updateStatus(ctx, &dataset); err != nil {
 				log.Error(err, "unable to update status when deleting dataset")
 				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 			}
 
-			if gerr, ok := err.(*googleapi.Error); ok && gerr.Code != 404 {
+			if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != 404 {
 				log.Info("Unable to delete dataset", "error", err)
-				return ctrl.Result{}, nil
+				return ctrl.Result{}, err
 			}
 
 			log.Info("Dataset not found in GCP, removing finalizer")
+		} else {
+			r.recordOutcome(dataset, outcomeDelete)
+			deleted := dataset
+			deleted.Spec.Project = gcpProject
+			r.audit(ctx, deleted, datasetDiff{AccessRemove: access})
+		}
+	}
+
+	if r.dryRun != nil {
+		// The planned delete has been logged and counted by dryRun. The
+		// finalizer is still removed, so that the resource doesn't hang in
+		// Terminating until dry-run is turned off.
+		if action, ok := r.dryRun.PlannedAction(gcpProject, dataset.Spec.Name); ok {
+			log.Info("Dry-run, removing finalizer without deleting from BigQuery", "plannedAction", action)
 		}
 	}
 
@@ -331,7 +671,12 @@ func (r *BigQueryDatasetReconciler) onDelete(ctx context.Context, dataset google
 	return ctrl.Result{}, nil
 }
 
-func (r *BigQueryDatasetReconciler) onCreate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, hash string) error {
+// onCreate creates the dataset in BigQuery, and counts it as outcome, which is
+// either outcomeCreate or outcomeRecreate.
+func (r *BigQueryDatasetReconciler) onCreate(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, hash, outcome string) (err error) {
+	ctx, span := startSpan(ctx, "onCreate", dataset)
+	defer func() { endSpan(span, err) }()
+
 	log := log.FromContext(ctx)
 
 	dataset.Status.CreationTime = int(time.Now().Unix())
@@ -346,37 +691,128 @@ func (r *BigQueryDatasetReconciler) onCreate(ctx context.Context, dataset google
 	})
 	dataset.Status.SynchronizationHash = hash
 
-	labels := map[string]string{
-		"team": dataset.GetNamespace(),
-	}
-
-	if metav1.HasLabel(dataset.ObjectMeta, "app") {
-		labels["app"] = dataset.GetLabels()["app"]
-	}
-
-	err := r.bigqueryClient.Create(ctx, dataset.Spec.Project, &bigquery.DatasetMetadata{
+	access := ensureBQratorOwner(createAccessList(dataset), r.config.OwnerEmail)
+	err = r.bigqueryClient.Create(ctx, dataset.Spec.Project, &bigquery.DatasetMetadata{
 		Name:        dataset.Spec.Name,
 		Location:    dataset.Spec.Location,
 		Description: dataset.Spec.Description,
-		Access:      ensureBQratorOwner(createAccessList(dataset)),
-		Labels:      labels,
+		Access:      access,
+		Labels:      datasetLabels(dataset),
 	})
 	if err != nil {
 		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 409 {
+			// A recreate follows a 404 from Get, so a 409 here means BigQuery
+			// hasn't caught up yet. Retry later instead of going back to onUpdate.
+			if outcome == outcomeRecreate {
+				return fmt.Errorf("dataset %s was not found, but already exists: %w", dataset.Spec.Name, err)
+			}
 			log.Info("Dataset already exists")
 			return r.onUpdate(ctx, dataset, hash)
 		}
 		log.Error(err, "unable to create dataset")
 		return err
 	}
+	r.recordOutcome(dataset, outcome)
+	r.audit(ctx, dataset, datasetDiff{AccessAdd: access})
 
-	if err := r.Status().Update(ctx, &dataset); err != nil {
+	if err := r.updateStatus(ctx, &dataset); err != nil {
 		log.Error(err, "unable to update status")
 		return err
 	}
 	return nil
 }
 
+// updateStatus persists the status of the dataset, or records the planned
+// action in dry-run mode.
+func (r *BigQueryDatasetReconciler) updateStatus(ctx context.Context, dataset *google_nais_io_v1.BigQueryDataset) error {
+	if r.dryRun != nil {
+		return r.recordPlan(ctx, dataset, dataset.Spec.Project)
+	}
+	return r.Status().Update(ctx, dataset)
+}
+
+// recordPlan sets the "DryRun" and "Diff" conditions on the latest version of
+// the dataset, leaving the rest of its status as it was before this reconcile.
+func (r *BigQueryDatasetReconciler) recordPlan(ctx context.Context, dataset *google_nais_io_v1.BigQueryDataset, projectID string) error {
+	condition := metav1.Condition{
+		Type:               "DryRun",
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Time(metav1.NowMicro()),
+		Reason:             "NoChanges",
+		Message:            "No changes would be made in BigQuery",
+	}
+	if action, ok := r.dryRun.PlannedAction(projectID, dataset.Spec.Name); ok {
+		condition.Reason = "ChangesPlanned"
+		condition.Message = action
+	}
+
+	latest := &google_nais_io_v1.BigQueryDataset{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(dataset), latest); err != nil {
+		return err
+	}
+	changed := meta.SetStatusCondition(&latest.Status.Conditions, condition)
+	if diff := meta.FindStatusCondition(dataset.Status.Conditions, "Diff"); diff != nil {
+		changed = meta.SetStatusCondition(&latest.Status.Conditions, *diff) || changed
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, latest)
+}
+
+// recordOutcome counts a change made in BigQuery. Nothing is counted in
+// dry-run mode, where no changes are made.
+func (r *BigQueryDatasetReconciler) recordOutcome(dataset google_nais_io_v1.BigQueryDataset, outcome string) {
+	if r.dryRun != nil {
+		return
+	}
+	metrics.BigQueryDatasetOutcomes.WithLabelValues(outcome, dataset.Namespace).Inc()
+}
+
+// audit writes an audit record for every access entry in diff. Failing to
+// write the audit records doesn't fail the reconcile, since the changes have
+// already been made.
+func (r *BigQueryDatasetReconciler) audit(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset, diff datasetDiff) {
+	if r.auditSink == nil {
+		return
+	}
+
+	operator := r.config.OwnerEmail
+	if r.identity != nil {
+		identity, err := r.identity.Identity(ctx)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "unable to determine the identity of BigQuery calls for audit records")
+		} else {
+			operator = identity
+		}
+	}
+	records := auditRecords(dataset, diff, operator, r.dryRun != nil)
+	if err := r.auditSink.Audit(ctx, records); err != nil {
+		log.FromContext(ctx).Error(err, "unable to write audit records")
+	}
+}
+
+// event records a Kubernetes event on the dataset, if the reconciler has an
+// event recorder.
+func (r *BigQueryDatasetReconciler) event(dataset *google_nais_io_v1.BigQueryDataset, eventType, reason, action, note string) {
+	if r.recorder == nil {
+		return
+	}
+	r.recorder.Eventf(dataset, nil, eventType, reason, action, "%s", truncate(note, maxEventNoteLength))
+}
+
+// datasetLabels returns the labels bqrator sets on the dataset in BigQuery.
+func datasetLabels(dataset google_nais_io_v1.BigQueryDataset) map[string]string {
+	labels := map[string]string{
+		"team": dataset.GetNamespace(),
+	}
+
+	if metav1.HasLabel(dataset.ObjectMeta, "app") {
+		labels["app"] = dataset.GetLabels()["app"]
+	}
+	return labels
+}
+
 func createAccessList(dataset google_nais_io_v1.BigQueryDataset) []*bigquery.AccessEntry {
 	var access []*bigquery.AccessEntry
 	for _, member := range dataset.Spec.Access {
@@ -390,6 +826,36 @@ func createAccessList(dataset google_nais_io_v1.BigQueryDataset) []*bigquery.Acc
 	return access
 }
 
+// mergeAccess returns the desired access entries, followed by the existing ones
+// for entities that aren't in desired, and bqrator as owner. Access granted
+// outside of bqrator is kept, but the desired role wins for entities in both.
+// Duplicates are left out, as BigQuery wouldn't keep them either.
+func mergeAccess(desired, existing []*bigquery.AccessEntry, bqratorEmail string) []*bigquery.AccessEntry {
+	var access []*bigquery.AccessEntry
+	seen := map[accessEntryKey]bool{}
+	add := func(entry *bigquery.AccessEntry) {
+		if key := keyOf(entry); !seen[key] {
+			seen[key] = true
+			access = append(access, entry)
+		}
+	}
+
+	for _, member := range desired {
+		add(member)
+	}
+	for _, existingMember := range removeDeletedServiceAccounts(existing) {
+		// Entity will be empty string for view access, so we only compare on entity if it's not empty
+		if existingMember.Entity != "" && slices.ContainsFunc(desired, func(member *bigquery.AccessEntry) bool {
+			return member.Entity == existingMember.Entity
+		}) {
+			continue
+		}
+		add(existingMember)
+	}
+
+	return ensureBQratorOwner(access, bqratorEmail)
+}
+
 func removeDeletedServiceAccounts(accessList []*bigquery.AccessEntry) []*bigquery.AccessEntry {
 	var newAccessList []*bigquery.AccessEntry
 	for _, entry := range accessList {
@@ -401,8 +867,7 @@ func removeDeletedServiceAccounts(accessList []*bigquery.AccessEntry) []*bigquer
 	return newAccessList
 }
 
-func ensureBQratorOwner(in []*bigquery.AccessEntry) []*bigquery.AccessEntry {
-	bqratorEmail := os.Getenv("SA_ACCOUNT_EMAIL")
+func ensureBQratorOwner(in []*bigquery.AccessEntry, bqratorEmail string) []*bigquery.AccessEntry {
 	if bqratorEmail == "" {
 		return in
 	}
@@ -2,15 +2,25 @@ package controllers
 
 import (
 	"context"
+	"net/http"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/google/go-cmp/cmp"
+	"github.com/nais/bqrator/pkg/fakebigquery"
 	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestBigqueryDatasetController(t *testing.T) {
@@ -67,11 +77,12 @@ func TestBigqueryDatasetController(t *testing.T) {
 func TestBigqueryDatasetControllerAlreadyExistsInGCP(t *testing.T) {
 	ctx := context.Background()
 
-	bqMock.Create(ctx, defaultGCPProjectID, &bigquery.DatasetMetadata{
-		Name:         "test-set-exists",
-		Location:     "europe-north1",
-		CreationTime: time.Now(),
-	})
+	if err := bqClient.Create(ctx, defaultGCPProjectID, &bigquery.DatasetMetadata{
+		Name:     "test-set-exists",
+		Location: "europe-north1",
+	}); err != nil {
+		t.Fatal(err)
+	}
 	dataset := naisv1.BigQueryDataset{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-set-exists",
@@ -173,7 +184,7 @@ func TestBigqueryDatasetControllerUpdate(t *testing.T) {
 		t.Fatal("Never got the updated dataset from k8s")
 	}
 
-	metadata, err := bqMock.Get(ctx, defaultGCPProjectID, dataset.Spec.Name)
+	metadata, err := bqClient.Get(ctx, defaultGCPProjectID, dataset.Spec.Name)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -194,6 +205,17 @@ func TestBigqueryDatasetControllerUpdate(t *testing.T) {
 	if !cmp.Equal(metadata.Access, expected) {
 		t.Error(cmp.Diff(metadata.Access, expected))
 	}
+
+	diff := meta.FindStatusCondition(dataset.Status.Conditions, "Diff")
+	if diff == nil {
+		t.Fatal("expected 'Diff' condition, but was not found")
+	}
+	if diff.Reason != "ChangesApplied" {
+		t.Errorf("expected reason 'ChangesApplied', got %q", diff.Reason)
+	}
+	if !strings.Contains(diff.Message, "add READER user:mockuser1337@nav.no") {
+		t.Errorf("expected diff to contain added access entry, got %q", diff.Message)
+	}
 }
 
 func TestBigqueryDatasetControllerDelete(t *testing.T) {
@@ -238,13 +260,378 @@ func TestBigqueryDatasetControllerDelete(t *testing.T) {
 	}
 
 	gotten = eventually(100*time.Millisecond, 10, func() bool {
-		return !bqMock.HasDataset(defaultGCPProjectID, dataset.Spec.Name)
+		return !bqServer.HasDataset(defaultGCPProjectID, dataset.Spec.Name)
 	})
 	if !gotten {
 		t.Fatalf("Failed delete dataset from state")
 	}
 }
 
+func TestBigqueryDatasetControllerPaused(t *testing.T) {
+	ctx := context.Background()
+
+	dataset := naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-set-paused",
+			Namespace: defaultNamespace,
+			Annotations: map[string]string{
+				pausedAnnotation: "true",
+			},
+		},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:        "test-dataset-paused",
+			Description: "test description",
+			Location:    "europe-north1",
+		},
+	}
+
+	if err := k8sClient.Create(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+
+	var err error
+	gotten := eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return err == nil && meta.IsStatusConditionTrue(dataset.Status.Conditions, "Paused")
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Dataset never got the 'Paused' condition")
+	}
+
+	if bqServer.HasDataset(defaultGCPProjectID, dataset.Spec.Name) {
+		t.Fatal("expected paused dataset not to be created in GCP")
+	}
+
+	delete(dataset.Annotations, pausedAnnotation)
+	if err := k8sClient.Update(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to unpause dataset: %v", err)
+	}
+
+	gotten = eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return err == nil && dataset.Status.CreationTime > 0
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Dataset was never created after unpausing")
+	}
+
+	if meta.FindStatusCondition(dataset.Status.Conditions, "Paused") != nil {
+		t.Error("expected 'Paused' condition to be removed")
+	}
+	if !bqServer.HasDataset(defaultGCPProjectID, dataset.Spec.Name) {
+		t.Error("expected dataset to be created in GCP after unpausing")
+	}
+}
+
+// TestReconcilePaused covers pausing through the namespace, and deleting a
+// paused dataset, against a fake Kubernetes client and the fake BigQuery
+// server.
+func TestReconcilePaused(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	setup := func(t *testing.T, namespaceAnnotations map[string]string) (*fakebigquery.Server, *BigQueryDatasetReconciler, *corev1.Namespace, *naisv1.BigQueryDataset) {
+		t.Helper()
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "team",
+			Labels:      map[string]string{namespaceProjectLabel: "proj"},
+			Annotations: namespaceAnnotations,
+		}}
+		dataset := &naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "team"},
+			Spec: naisv1.BigQueryDatasetSpec{
+				Name:            "bq_ds",
+				Location:        "europe-north1",
+				CascadingDelete: true,
+			},
+		}
+		c := fake.NewClientBuilder().
+			WithScheme(s).
+			WithStatusSubresource(&naisv1.BigQueryDataset{}).
+			WithObjects(ns, dataset).
+			Build()
+		server, bq := newFakeBigQuery(t)
+		return server, NewBigQueryDatasetReconciler(c, s, bq), ns, dataset
+	}
+	reconcile := func(t *testing.T, r *BigQueryDatasetReconciler, dataset *naisv1.BigQueryDataset) {
+		t.Helper()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}}
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if err := r.Get(ctx, req.NamespacedName, dataset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("namespace annotation", func(t *testing.T) {
+		server, r, ns, dataset := setup(t, map[string]string{pausedAnnotation: "true"})
+
+		reconcile(t, r, dataset)
+		if !meta.IsStatusConditionTrue(dataset.Status.Conditions, "Paused") {
+			t.Errorf("expected 'Paused' condition, got %v", dataset.Status.Conditions)
+		}
+		if server.HasDataset("proj", "bq_ds") {
+			t.Fatal("expected dataset in paused namespace not to be created in GCP")
+		}
+
+		delete(ns.Annotations, pausedAnnotation)
+		if err := r.Update(ctx, ns); err != nil {
+			t.Fatal(err)
+		}
+		reconcile(t, r, dataset)
+		if meta.FindStatusCondition(dataset.Status.Conditions, "Paused") != nil {
+			t.Error("expected 'Paused' condition to be removed")
+		}
+		if !server.HasDataset("proj", "bq_ds") {
+			t.Error("expected dataset to be created in GCP after unpausing the namespace")
+		}
+	})
+
+	t.Run("cascading delete", func(t *testing.T) {
+		server, r, _, dataset := setup(t, nil)
+
+		reconcile(t, r, dataset)
+		if !server.HasDataset("proj", "bq_ds") {
+			t.Fatal("expected dataset to be created in GCP")
+		}
+
+		dataset.Annotations = map[string]string{pausedAnnotation: "true"}
+		if err := r.Update(ctx, dataset); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Delete(ctx, dataset); err != nil {
+			t.Fatal(err)
+		}
+		reconcile(t, r, dataset)
+
+		if !slices.Contains(dataset.Finalizers, finalizer) {
+			t.Error("expected finalizer to be kept on paused dataset")
+		}
+		if n := server.Requests(http.MethodDelete); n != 0 {
+			t.Errorf("expected no deletes in BigQuery while paused, got %d", n)
+		}
+		if !server.HasDataset("proj", "bq_ds") {
+			t.Error("expected paused dataset to be kept in GCP")
+		}
+	})
+}
+
+func TestBigqueryDatasetControllerResync(t *testing.T) {
+	ctx := context.Background()
+
+	dataset := naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-set-resync",
+			Namespace: defaultNamespace,
+		},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:        "test-dataset-resync",
+			Description: "test description",
+			Location:    "europe-north1",
+		},
+	}
+
+	if err := k8sClient.Create(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+
+	var err error
+	gotten := eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return err == nil && dataset.Status.CreationTime > 0
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Never got the dataset from k8s")
+	}
+
+	// Simulate drift in GCP that bqrator would not notice on its own
+	if err := bqClient.Update(ctx, defaultGCPProjectID, dataset.Spec.Name, bigquery.DatasetMetadataToUpdate{Description: "drifted"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	dataset.Annotations = map[string]string{resyncAnnotation: time.Now().Format(time.RFC3339)}
+	if err := k8sClient.Update(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to annotate dataset: %v", err)
+	}
+
+	gotten = eventually(100*time.Millisecond, 15, func() bool {
+		metadata, err := bqClient.Get(ctx, defaultGCPProjectID, dataset.Spec.Name)
+		return err == nil && metadata.Description == dataset.Spec.Description
+	})
+	if !gotten {
+		t.Fatal("Drifted description was never restored after setting the resync annotation")
+	}
+}
+
+func TestSynchronizationHash(t *testing.T) {
+	dataset := naisv1.BigQueryDataset{
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:     "ds",
+			Location: "europe-north1",
+		},
+	}
+
+	specHash, err := dataset.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("equals spec hash without annotation", func(t *testing.T) {
+		hash, err := synchronizationHash(dataset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != specHash {
+			t.Errorf("expected %q, got %q", specHash, hash)
+		}
+	})
+
+	t.Run("changes with annotation value", func(t *testing.T) {
+		first := dataset.DeepCopy()
+		first.Annotations = map[string]string{resyncAnnotation: "1"}
+		second := dataset.DeepCopy()
+		second.Annotations = map[string]string{resyncAnnotation: "2"}
+
+		firstHash, err := synchronizationHash(*first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secondHash, err := synchronizationHash(*second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if firstHash == specHash {
+			t.Error("expected annotation to change the hash")
+		}
+		if firstHash == secondHash {
+			t.Error("expected different annotation values to give different hashes")
+		}
+	})
+}
+
+func TestResyncDue(t *testing.T) {
+	now := int(time.Now().Unix())
+	tests := []struct {
+		name         string
+		interval     time.Duration
+		lastModified int
+		want         bool
+	}{
+		{name: "disabled", interval: 0, lastModified: now - 3600, want: false},
+		{name: "recently modified", interval: time.Hour, lastModified: now - 60, want: false},
+		{name: "interval passed", interval: time.Hour, lastModified: now - 7200, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBigQueryDatasetReconciler(nil, nil, nil)
+			r.config.ResyncInterval.Duration = tt.interval
+
+			dataset := naisv1.BigQueryDataset{}
+			dataset.Status.LastModifiedTime = tt.lastModified
+
+			if got := r.resyncDue(dataset); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBigqueryDatasetControllerNamespaceProjectChanged(t *testing.T) {
+	ctx := context.Background()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "project-change",
+			Labels: map[string]string{namespaceProjectLabel: "project-a"},
+		},
+	}
+	if err := k8sClient.Create(ctx, ns); err != nil {
+		t.Fatalf("Failed to create namespace: %v", err)
+	}
+
+	dataset := naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-set-project-change",
+			Namespace: ns.Name,
+		},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:        "test-dataset-project-change",
+			Description: "test description",
+			Location:    "europe-north1",
+		},
+	}
+
+	if err := k8sClient.Create(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+
+	var err error
+	gotten := eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return err == nil && dataset.Status.CreationTime > 0
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Never got the dataset from k8s")
+	}
+
+	if got := dataset.GetAnnotations()[projectAnnotation]; got != "project-a" {
+		t.Errorf("expected %s annotation to be %q, got %q", projectAnnotation, "project-a", got)
+	}
+
+	ns.Labels[namespaceProjectLabel] = "project-b"
+	if err := k8sClient.Update(ctx, ns); err != nil {
+		t.Fatalf("Failed to update namespace: %v", err)
+	}
+
+	gotten = eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		ready := meta.FindStatusCondition(dataset.Status.Conditions, "Ready")
+		return err == nil && ready != nil && ready.Reason == "ProjectChanged"
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Project change was never flagged on the dataset")
+	}
+
+	if bqServer.HasDataset("project-b", dataset.Spec.Name) {
+		t.Error("expected dataset not to be created in the new project")
+	}
+
+	ns.Labels[namespaceProjectLabel] = "project-a"
+	if err := k8sClient.Update(ctx, ns); err != nil {
+		t.Fatalf("Failed to update namespace: %v", err)
+	}
+
+	gotten = eventually(100*time.Millisecond, 10, func() bool {
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return err == nil && meta.IsStatusConditionTrue(dataset.Status.Conditions, "Ready")
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !gotten {
+		t.Fatal("Dataset never became ready after the namespace project was restored")
+	}
+}
+
 func TestRemoveDeletedServiceAccounts(t *testing.T) {
 	t.Run("removes deleted service accounts", func(t *testing.T) {
 		existing := []*bigquery.AccessEntry{
@@ -320,8 +707,8 @@ func TestBigqueryDatasetControllerCascadingDeleteOnlyChange(t *testing.T) {
 		t.Fatal("Dataset never reached Created state")
 	}
 
-	// Record the update count after initial creation (onCreate uses Create, not Update)
-	updateCountAfterCreate := bqMock.GetUpdateCount()
+	// Record the number of updates after initial creation (onCreate uses Create, not Update)
+	updateCountAfterCreate := bqServer.Requests(http.MethodPatch)
 
 	// Change only CascadingDelete — this must not trigger a GCP Update call
 	creationHash := dataset.Status.SynchronizationHash
@@ -343,9 +730,9 @@ func TestBigqueryDatasetControllerCascadingDeleteOnlyChange(t *testing.T) {
 
 	// The GCP Update must NOT have been called — only CascadingDelete changed, which
 	// has no effect on the BigQuery dataset itself.
-	if bqMock.GetUpdateCount() != updateCountAfterCreate {
-		t.Errorf("expected no GCP Update call for a CascadingDelete-only change, but updateCount changed from %d to %d",
-			updateCountAfterCreate, bqMock.GetUpdateCount())
+	if bqServer.Requests(http.MethodPatch) != updateCountAfterCreate {
+		t.Errorf("expected no GCP Update call for a CascadingDelete-only change, but the number of updates changed from %d to %d",
+			updateCountAfterCreate, bqServer.Requests(http.MethodPatch))
 	}
 }
 
@@ -601,6 +988,72 @@ func TestAccessSetEqual(t *testing.T) {
 	})
 }
 
+func TestDiffDataset(t *testing.T) {
+	dataset := naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "myns"},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:        "ds",
+			Description: "desc",
+		},
+	}
+	reader := &bigquery.AccessEntry{Role: "READER", EntityType: bigquery.UserEmailEntity, Entity: "reader@example.com"}
+	writer := &bigquery.AccessEntry{Role: "WRITER", EntityType: bigquery.UserEmailEntity, Entity: "writer@example.com"}
+	view := &bigquery.AccessEntry{
+		Role:       "READER",
+		EntityType: bigquery.ViewEntity,
+		View:       &bigquery.Table{ProjectID: "proj", DatasetID: "other", TableID: "view"},
+	}
+
+	t.Run("no changes", func(t *testing.T) {
+		existing := &bigquery.DatasetMetadata{
+			Name:        "ds",
+			Description: "desc",
+			Access:      []*bigquery.AccessEntry{reader},
+			Labels:      map[string]string{"team": "myns"},
+		}
+
+		diff := diffDataset(dataset, existing, []*bigquery.AccessEntry{reader})
+		if !diff.empty() {
+			t.Errorf("expected empty diff, got %q", diff)
+		}
+		if diff.String() != "No changes" {
+			t.Errorf("unexpected summary %q", diff)
+		}
+		if len(diff.AccessKeep) != 1 {
+			t.Errorf("expected 1 kept access entry, got %d", len(diff.AccessKeep))
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		existing := &bigquery.DatasetMetadata{
+			Name:        "ds",
+			Description: "old",
+			Access:      []*bigquery.AccessEntry{reader, view},
+			Labels:      map[string]string{},
+		}
+
+		diff := diffDataset(dataset, existing, []*bigquery.AccessEntry{reader, writer})
+		if diff.empty() {
+			t.Fatal("expected non-empty diff")
+		}
+
+		expected := `description "old" -> "desc"; label team "" -> "myns"; add WRITER user:writer@example.com; ` +
+			`remove READER view:proj.other.view; keep READER user:reader@example.com`
+		if diff.String() != expected {
+			t.Errorf("expected %q, got %q", expected, diff)
+		}
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("expected string to be unchanged, got %q", got)
+	}
+	if got := truncate("a long message", 9); got != "a long..." {
+		t.Errorf("expected truncated string, got %q", got)
+	}
+}
+
 func eventually(delay time.Duration, maxIterations int, f func() bool) bool {
 	for range maxIterations {
 		if f() {
@@ -611,3 +1064,86 @@ func eventually(delay time.Duration, maxIterations int, f func() bool) bool {
 	}
 	return false
 }
+
+// TestReconcileWithFakeBigQuery runs the reconciler against a fake Kubernetes
+// client and the fake BigQuery server, so that the whole path through
+// BigQueryWrapper and the client library is exercised without envtest.
+func TestReconcileWithFakeBigQuery(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	dataset := &naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "team"},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:            "bq_ds",
+			Location:        "europe-north1",
+			Description:     "first",
+			CascadingDelete: true,
+			Access:          []naisv1.DatasetAccess{{Role: "READER", UserByEmail: "reader@example.com"}},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(s).
+		WithStatusSubresource(&naisv1.BigQueryDataset{}).
+		WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{namespaceProjectLabel: "proj"}}},
+			dataset,
+		).
+		Build()
+
+	server, bq := newFakeBigQuery(t)
+	r := NewBigQueryDatasetReconciler(c, s, bq)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team", Name: "ds"}}
+
+	reconcile := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if err := c.Get(ctx, req.NamespacedName, dataset); err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile()
+	created, ok := server.Dataset("proj", "bq_ds")
+	if !ok {
+		t.Fatal("expected dataset to be created in BigQuery")
+	}
+	if created.Labels["team"] != "team" || created.Location != "europe-north1" || len(created.Access) != 1 || created.Access[0].UserByEmail != "reader@example.com" {
+		t.Errorf("unexpected dataset in BigQuery: %+v", created)
+	}
+	if !meta.IsStatusConditionTrue(dataset.Status.Conditions, "Ready") {
+		t.Errorf("expected dataset to be ready, got conditions %v", dataset.Status.Conditions)
+	}
+
+	dataset.Spec.Description = "second"
+	if err := c.Update(ctx, dataset); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	if updated, _ := server.Dataset("proj", "bq_ds"); updated.Description != "second" {
+		t.Errorf("expected description to be updated, got %q", updated.Description)
+	}
+
+	patches := server.Requests(http.MethodPatch)
+	reconcile()
+	if server.Requests(http.MethodPatch) != patches {
+		t.Error("expected no update when nothing changed")
+	}
+
+	if err := c.Delete(ctx, dataset); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	if server.HasDataset("proj", "bq_ds") {
+		t.Error("expected dataset to be deleted from BigQuery")
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+)
+
+// datasetDiff is the difference between the desired state of a
+// BigQueryDataset and the existing dataset in BigQuery.
+type datasetDiff struct {
+	Name         *valueChange
+	Description  *valueChange
+	Labels       map[string]valueChange
+	AccessAdd    []*bigquery.AccessEntry
+	AccessKeep   []*bigquery.AccessEntry
+	AccessRemove []*bigquery.AccessEntry
+}
+
+type valueChange struct {
+	From string
+	To   string
+}
+
+// diffDataset compares the desired state of dataset against existing. access is
+// the complete access list that will be sent to BigQuery, i.e. after merging
+// with the existing access entries.
+func diffDataset(dataset google_nais_io_v1.BigQueryDataset, existing *bigquery.DatasetMetadata, access []*bigquery.AccessEntry) datasetDiff {
+	diff := datasetDiff{
+		Labels: map[string]valueChange{},
+	}
+
+	if dataset.Spec.Name != existing.Name {
+		diff.Name = &valueChange{From: existing.Name, To: dataset.Spec.Name}
+	}
+	if dataset.Spec.Description != existing.Description {
+		diff.Description = &valueChange{From: existing.Description, To: dataset.Spec.Description}
+	}
+	for key, value := range datasetLabels(dataset) {
+		if existing.Labels[key] != value {
+			diff.Labels[key] = valueChange{From: existing.Labels[key], To: value}
+		}
+	}
+
+	existingKeys := make(map[accessEntryKey]struct{}, len(existing.Access))
+	for _, entry := range existing.Access {
+		existingKeys[keyOf(entry)] = struct{}{}
+	}
+	desiredKeys := make(map[accessEntryKey]struct{}, len(access))
+	for _, entry := range access {
+		desiredKeys[keyOf(entry)] = struct{}{}
+		if _, ok := existingKeys[keyOf(entry)]; ok {
+			diff.AccessKeep = append(diff.AccessKeep, entry)
+		} else {
+			diff.AccessAdd = append(diff.AccessAdd, entry)
+		}
+	}
+	for _, entry := range existing.Access {
+		if _, ok := desiredKeys[keyOf(entry)]; !ok {
+			diff.AccessRemove = append(diff.AccessRemove, entry)
+		}
+	}
+
+	return diff
+}
+
+// empty reports whether applying the diff would leave the dataset unchanged.
+func (d datasetDiff) empty() bool {
+	return d.Name == nil && d.Description == nil && len(d.Labels) == 0 && len(d.AccessAdd) == 0 && len(d.AccessRemove) == 0
+}
+
+// String returns a human-readable, single line summary of the diff.
+func (d datasetDiff) String() string {
+	if d.empty() {
+		return "No changes"
+	}
+	return strings.Join(d.changes(), "; ")
+}
+
+// changes returns one human-readable line per change in the diff, followed by
+// the access entries that are kept.
+func (d datasetDiff) changes() []string {
+	var changes []string
+	if d.Name != nil {
+		changes = append(changes, fmt.Sprintf("name %q -> %q", d.Name.From, d.Name.To))
+	}
+	if d.Description != nil {
+		changes = append(changes, fmt.Sprintf("description %q -> %q", d.Description.From, d.Description.To))
+	}
+	for _, key := range slices.Sorted(maps.Keys(d.Labels)) {
+		changes = append(changes, fmt.Sprintf("label %s %q -> %q", key, d.Labels[key].From, d.Labels[key].To))
+	}
+	for _, entry := range d.AccessAdd {
+		changes = append(changes, "add "+FormatAccessEntry(entry))
+	}
+	for _, entry := range d.AccessRemove {
+		changes = append(changes, "remove "+FormatAccessEntry(entry))
+	}
+	for _, entry := range d.AccessKeep {
+		changes = append(changes, "keep "+FormatAccessEntry(entry))
+	}
+	return changes
+}
+
+// FormatAccessEntry returns a short description of an access entry, such as
+// "READER user:foo@example.com" or "READER view:project.dataset.table".
+func FormatAccessEntry(e *bigquery.AccessEntry) string {
+	entityType, entity := accessEntity(e)
+	return fmt.Sprintf("%s %s:%s", e.Role, entityType, entity)
+}
+
+// accessEntity returns the type and name of the entity an access entry grants
+// access to. Views, routines and datasets are named by their full ID.
+func accessEntity(e *bigquery.AccessEntry) (string, string) {
+	switch {
+	case e.View != nil:
+		return "view", fmt.Sprintf("%s.%s.%s", e.View.ProjectID, e.View.DatasetID, e.View.TableID)
+	case e.Routine != nil:
+		return "routine", fmt.Sprintf("%s.%s.%s", e.Routine.ProjectID, e.Routine.DatasetID, e.Routine.RoutineID)
+	case e.Dataset != nil && e.Dataset.Dataset != nil:
+		return "dataset", fmt.Sprintf("%s.%s", e.Dataset.Dataset.ProjectID, e.Dataset.Dataset.DatasetID)
+	}
+	return entityTypeName(e.EntityType), e.Entity
+}
+
+func entityTypeName(t bigquery.EntityType) string {
+	switch t {
+	case bigquery.DomainEntity:
+		return "domain"
+	case bigquery.GroupEmailEntity:
+		return "group"
+	case bigquery.UserEmailEntity:
+		return "user"
+	case bigquery.SpecialGroupEntity:
+		return "specialGroup"
+	case bigquery.ViewEntity:
+		return "view"
+	case bigquery.IAMMemberEntity:
+		return "iamMember"
+	case bigquery.RoutineEntity:
+		return "routine"
+	case bigquery.DatasetEntity:
+		return "dataset"
+	}
+	return "unknown"
+}
+
+// truncate shortens s to at most n bytes, for use in condition messages and
+// events which have a maximum length.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n-3], "") + "..."
+}
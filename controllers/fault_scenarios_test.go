@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The scenarios below inject faults into the BigQuery calls of the reconciler
+// running in the test environment, and check that it converges once they stop.
+// Faults are scoped to the dataset of each scenario, so they don't affect
+// other tests.
+
+func TestFaultScenariosCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		faults     []Fault
+		staleReads int
+	}{
+		{
+			name:   "latency",
+			faults: []Fault{{Latency: 300 * time.Millisecond}},
+		},
+		{
+			name: "rate limited and unavailable",
+			faults: []Fault{
+				{Method: "Create", Code: http.StatusTooManyRequests, Times: 2},
+				{Method: "Create", Code: http.StatusInternalServerError, Times: 1},
+				{Method: "Create", Code: http.StatusServiceUnavailable, Times: 1},
+			},
+		},
+		{
+			name:   "response lost after create",
+			faults: []Fault{{Method: "Create", Code: http.StatusServiceUnavailable, Partial: true, Times: 1}},
+		},
+		{
+			name:       "eventual consistency after lost create",
+			faults:     []Fault{{Method: "Create", Code: http.StatusServiceUnavailable, Partial: true, Times: 1}},
+			staleReads: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dataset := faultScenarioDataset(tt.name)
+			bqFaults.StaleReadsAfterCreate(dataset.Spec.Name, tt.staleReads)
+			for _, fault := range tt.faults {
+				fault.Dataset = dataset.Spec.Name
+				bqFaults.Inject(fault)
+			}
+			t.Cleanup(func() { bqFaults.Clear(dataset.Spec.Name) })
+
+			if err := k8sClient.Create(ctx, &dataset); err != nil {
+				t.Fatalf("Failed to create dataset: %v", err)
+			}
+
+			waitForDataset(t, &dataset, func() bool {
+				return isUpToDate(dataset)
+			})
+
+			metadata, err := bqClient.Get(ctx, defaultGCPProjectID, dataset.Spec.Name)
+			if err != nil {
+				t.Fatalf("expected dataset in BigQuery: %v", err)
+			}
+			if metadata.Description != dataset.Spec.Description {
+				t.Errorf("expected description %q, got %q", dataset.Spec.Description, metadata.Description)
+			}
+		})
+	}
+}
+
+func TestFaultScenariosUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		faults     []Fault
+		diffReason string
+	}{
+		{
+			name:       "conflicting update",
+			faults:     []Fault{{Method: "Update", Code: http.StatusPreconditionFailed, Times: 2}},
+			diffReason: "ChangesApplied",
+		},
+		{
+			name: "unavailable during update",
+			faults: []Fault{
+				{Method: "Get", Code: http.StatusServiceUnavailable, Times: 1},
+				{Method: "Update", Code: http.StatusInternalServerError, Times: 1},
+			},
+			diffReason: "ChangesApplied",
+		},
+		{
+			// The retry finds the change already applied.
+			name:       "response lost after update",
+			faults:     []Fault{{Method: "Update", Code: http.StatusServiceUnavailable, Partial: true, Times: 1}},
+			diffReason: "NoChanges",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dataset := faultScenarioDataset(tt.name)
+			t.Cleanup(func() { bqFaults.Clear(dataset.Spec.Name) })
+
+			if err := k8sClient.Create(ctx, &dataset); err != nil {
+				t.Fatalf("Failed to create dataset: %v", err)
+			}
+			waitForDataset(t, &dataset, func() bool {
+				return isUpToDate(dataset)
+			})
+
+			for _, fault := range tt.faults {
+				fault.Dataset = dataset.Spec.Name
+				bqFaults.Inject(fault)
+			}
+
+			dataset.Spec.Description = "updated description"
+			if err := k8sClient.Update(ctx, &dataset); err != nil {
+				t.Fatalf("Failed to update dataset: %v", err)
+			}
+
+			hash, err := synchronizationHash(dataset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitForDataset(t, &dataset, func() bool {
+				return isUpToDate(dataset) && dataset.Status.SynchronizationHash == hash
+			})
+
+			metadata, err := bqClient.Get(ctx, defaultGCPProjectID, dataset.Spec.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata.Description != "updated description" {
+				t.Errorf("expected updated description, got %q", metadata.Description)
+			}
+			if diff := meta.FindStatusCondition(dataset.Status.Conditions, "Diff"); diff == nil || diff.Reason != tt.diffReason {
+				t.Errorf("expected 'Diff' condition with reason %q, got %v", tt.diffReason, diff)
+			}
+		})
+	}
+}
+
+func TestFaultScenariosDelete(t *testing.T) {
+	ctx := context.Background()
+	dataset := faultScenarioDataset("unavailable during delete")
+	t.Cleanup(func() { bqFaults.Clear(dataset.Spec.Name) })
+
+	if err := k8sClient.Create(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	waitForDataset(t, &dataset, func() bool {
+		return isUpToDate(dataset)
+	})
+
+	bqFaults.Inject(Fault{Method: "Delete", Dataset: dataset.Spec.Name, Code: http.StatusServiceUnavailable})
+	if err := k8sClient.Delete(ctx, &dataset); err != nil {
+		t.Fatalf("Failed to delete dataset: %v", err)
+	}
+
+	waitForDataset(t, &dataset, func() bool {
+		ready := meta.FindStatusCondition(dataset.Status.Conditions, "Ready")
+		return ready != nil && ready.Status == metav1.ConditionFalse && ready.Reason == "DeleteError"
+	})
+	if !bqServer.HasDataset(defaultGCPProjectID, dataset.Spec.Name) {
+		t.Fatal("expected dataset to remain in BigQuery while deletes fail")
+	}
+
+	calls := bqFaults.Calls("Delete", dataset.Spec.Name)
+	bqFaults.Clear(dataset.Spec.Name)
+
+	gone := eventually(100*time.Millisecond, 50, func() bool {
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, &dataset)
+		return apierrors.IsNotFound(err)
+	})
+	if !gone {
+		t.Fatal("expected BigQueryDataset to be deleted once BigQuery recovers")
+	}
+	if bqServer.HasDataset(defaultGCPProjectID, dataset.Spec.Name) {
+		t.Error("expected dataset to be deleted from BigQuery")
+	}
+	if bqFaults.Calls("Delete", dataset.Spec.Name) <= calls {
+		t.Error("expected delete to be retried")
+	}
+}
+
+// faultScenarioDataset returns a dataset named after the scenario.
+func faultScenarioDataset(scenario string) naisv1.BigQueryDataset {
+	name := "fault-" + strings.ReplaceAll(scenario, " ", "-")
+	return naisv1.BigQueryDataset{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaultNamespace,
+		},
+		Spec: naisv1.BigQueryDatasetSpec{
+			Name:        strings.ReplaceAll(name, "-", "_"),
+			Description: "fault scenario " + scenario,
+			Location:    "europe-north1",
+			Access: []naisv1.DatasetAccess{
+				{
+					Role:        "READER",
+					UserByEmail: "test@helper.dev",
+				},
+			},
+			CascadingDelete: true,
+		},
+	}
+}
+
+// waitForDataset refreshes dataset until done returns true, failing the test
+// if it doesn't within 5 seconds.
+func waitForDataset(t *testing.T, dataset *naisv1.BigQueryDataset, done func() bool) {
+	t.Helper()
+
+	var err error
+	ok := eventually(100*time.Millisecond, 50, func() bool {
+		err = k8sClient.Get(context.Background(), types.NamespacedName{Namespace: dataset.Namespace, Name: dataset.Name}, dataset)
+		return err == nil && done()
+	})
+	if err != nil {
+		t.Fatalf("Failed to get dataset: %v", err)
+	} else if !ok {
+		t.Fatalf("dataset never converged, conditions: %v", dataset.Status.Conditions)
+	}
+}
+
+func isUpToDate(dataset naisv1.BigQueryDataset) bool {
+	ready := meta.FindStatusCondition(dataset.Status.Conditions, "Ready")
+	return dataset.Status.CreationTime > 0 && ready != nil && ready.Status == metav1.ConditionTrue && ready.Reason == "UpToDate"
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InventoryEntry describes a BigQueryDataset and its synchronization with
+// BigQuery.
+type InventoryEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Team      string `json:"team"`
+	// ProjectID is the project the dataset was synchronized to, or empty if it
+	// hasn't been yet.
+	ProjectID  string             `json:"projectID"`
+	Dataset    string             `json:"dataset"`
+	Location   string             `json:"location"`
+	Conditions []metav1.Condition `json:"conditions"`
+	// LastSync is when the dataset was last compared with BigQuery, or nil if
+	// it hasn't been.
+	LastSync *time.Time `json:"lastSync"`
+	// Access counts the access entries of the spec by role.
+	Access map[string]int `json:"access"`
+}
+
+// inventoryColumns are the columns of the CSV inventory. Conditions other than
+// Ready are left out, to keep one row per dataset.
+var inventoryColumns = []string{"namespace", "name", "team", "projectID", "dataset", "location", "ready", "reason", "lastSync", "access"}
+
+// InventoryHandler serves a read-only inventory of all BigQueryDatasets, as
+// JSON, or as CSV when asked for with ?format=csv or an Accept header of
+// text/csv. It should be given a cached reader, like DatasetCollector.
+type InventoryHandler struct {
+	Reader client.Reader
+}
+
+var _ http.Handler = &InventoryHandler{}
+
+func (h *InventoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("unknown format %q, must be json or csv", format), http.StatusBadRequest)
+		return
+	}
+
+	var datasets google_nais_io_v1.BigQueryDatasetList
+	if err := h.Reader.List(r.Context(), &datasets); err != nil {
+		http.Error(w, "listing BigQueryDatasets: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	entries := make([]InventoryEntry, 0, len(datasets.Items))
+	for _, dataset := range datasets.Items {
+		entries = append(entries, inventoryEntry(dataset))
+	}
+	slices.SortFunc(entries, func(a, b InventoryEntry) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		_ = writeInventoryCSV(w, entries)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(entries)
+}
+
+func inventoryEntry(dataset google_nais_io_v1.BigQueryDataset) InventoryEntry {
+	entry := InventoryEntry{
+		Namespace:  dataset.Namespace,
+		Name:       dataset.Name,
+		Team:       dataset.Namespace,
+		ProjectID:  dataset.GetAnnotations()[projectAnnotation],
+		Dataset:    dataset.Spec.Name,
+		Location:   dataset.Spec.Location,
+		Conditions: dataset.Status.Conditions,
+		Access:     map[string]int{},
+	}
+	if entry.Conditions == nil {
+		entry.Conditions = []metav1.Condition{}
+	}
+	if dataset.Status.LastModifiedTime > 0 {
+		lastSync := time.Unix(int64(dataset.Status.LastModifiedTime), 0).UTC()
+		entry.LastSync = &lastSync
+	}
+	for _, access := range dataset.Spec.Access {
+		entry.Access[access.Role]++
+	}
+	return entry
+}
+
+func writeInventoryCSV(w io.Writer, entries []InventoryEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(inventoryColumns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ready, reason := string(metav1.ConditionUnknown), ""
+		if condition := meta.FindStatusCondition(entry.Conditions, "Ready"); condition != nil {
+			ready, reason = string(condition.Status), condition.Reason
+		}
+		lastSync := ""
+		if entry.LastSync != nil {
+			lastSync = entry.LastSync.Format(time.RFC3339)
+		}
+		access := make([]string, 0, len(entry.Access))
+		for _, role := range slices.Sorted(maps.Keys(entry.Access)) {
+			access = append(access, role+"="+strconv.Itoa(entry.Access[role]))
+		}
+
+		err := cw.Write([]string{
+			entry.Namespace, entry.Name, entry.Team, entry.ProjectID, entry.Dataset, entry.Location,
+			ready, reason, lastSync, strings.Join(access, " "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInventoryHandler(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	synced := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "pending"},
+			Spec:       naisv1.BigQueryDatasetSpec{Name: "pending", Location: "europe-north1"},
+		},
+		&naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "team-a",
+				Name:        "synced",
+				Annotations: map[string]string{projectAnnotation: "proj-a"},
+			},
+			Spec: naisv1.BigQueryDatasetSpec{
+				Name:     "synced_ds",
+				Location: "europe-north1",
+				Access: []naisv1.DatasetAccess{
+					{Role: "READER", UserByEmail: "a@example.com"},
+					{Role: "READER", UserByEmail: "b@example.com"},
+					{Role: "WRITER", UserByEmail: "c@example.com"},
+				},
+			},
+			Status: naisv1.BigQueryDatasetStatus{
+				LastModifiedTime: int(synced.Unix()),
+				Conditions: []metav1.Condition{
+					{Type: "Ready", Status: metav1.ConditionTrue, Reason: "UpToDate"},
+				},
+			},
+		},
+	).Build()
+	h := &InventoryHandler{Reader: c}
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("json", func(t *testing.T) {
+		rec := get("/datasets", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+		}
+		var entries []InventoryEntry
+		if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		expected := []InventoryEntry{
+			{
+				Namespace:  "team-a",
+				Name:       "synced",
+				Team:       "team-a",
+				ProjectID:  "proj-a",
+				Dataset:    "synced_ds",
+				Location:   "europe-north1",
+				Conditions: []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "UpToDate"}},
+				LastSync:   &synced,
+				Access:     map[string]int{"READER": 2, "WRITER": 1},
+			},
+			{
+				Namespace:  "team-b",
+				Name:       "pending",
+				Team:       "team-b",
+				Dataset:    "pending",
+				Location:   "europe-north1",
+				Conditions: []metav1.Condition{},
+				Access:     map[string]int{},
+			},
+		}
+		if diff := cmp.Diff(expected, entries); diff != "" {
+			t.Errorf("unexpected inventory (-want +got):\n%s", diff)
+		}
+	})
+
+	want := `namespace,name,team,projectID,dataset,location,ready,reason,lastSync,access
+team-a,synced,team-a,proj-a,synced_ds,europe-north1,True,UpToDate,2026-10-01T12:00:00Z,READER=2 WRITER=1
+team-b,pending,team-b,,pending,europe-north1,Unknown,,,
+`
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"csv from query":  get("/datasets?format=csv", ""),
+		"csv from accept": get("/datasets", "text/csv"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+				t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+			}
+			if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+				t.Errorf("unexpected CSV (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		if rec := get("/datasets?format=xml", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rec.Code)
+		}
+	})
+}
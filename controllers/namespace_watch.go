@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// namespaceChanged only lets through namespace updates that change how the
+// BigQueryDatasets in the namespace are reconciled, i.e. the pause annotation
+// or the namespace metadata read by the project resolver. Creates are let
+// through too, as a namespace appears in the cache when it starts matching
+// the namespace selector of the shard.
+func namespaceChanged(resolver ProjectResolver) predicate.Predicate {
+	labelKeys, annotationKeys := []string{}, []string{pausedAnnotation}
+	if reader, ok := resolver.(namespaceMetadataReader); ok {
+		labels, annotations := reader.namespaceKeys()
+		labelKeys = append(labelKeys, labels...)
+		annotationKeys = append(annotationKeys, annotations...)
+	}
+
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return true },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return anyChanged(labelKeys, e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) ||
+				anyChanged(annotationKeys, e.ObjectOld.GetAnnotations(), e.ObjectNew.GetAnnotations())
+		},
+	}
+}
+
+func anyChanged(keys []string, old, new map[string]string) bool {
+	for _, key := range keys {
+		oldValue, oldOk := old[key]
+		newValue, newOk := new[key]
+		if oldOk != newOk || oldValue != newValue {
+			return true
+		}
+	}
+	return false
+}
+
+// datasetsInNamespace returns a reconcile request for every BigQueryDataset in
+// the given namespace.
+func (r *BigQueryDatasetReconciler) datasetsInNamespace(ctx context.Context, ns client.Object) []reconcile.Request {
+	var datasets google_nais_io_v1.BigQueryDatasetList
+	if err := r.List(ctx, &datasets, client.InNamespace(ns.GetName())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list BigQueryDatasets in namespace", "namespace", ns.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(datasets.Items))
+	for _, dataset := range datasets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&dataset)})
+	}
+	return requests
+}
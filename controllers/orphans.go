@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nais/bqrator/pkg/metrics"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var errNotScanned = errors.New("orphaned datasets have not been scanned for yet")
+
+// Orphan is a dataset labelled with a team by bqrator, that no BigQueryDataset
+// in the team's namespace manages.
+type Orphan struct {
+	Team      string `json:"team"`
+	ProjectID string `json:"projectID"`
+	Dataset   string `json:"dataset"`
+}
+
+// TeamScanError is the reason a team's orphans could not be found.
+type TeamScanError struct {
+	Team string
+	Err  error
+}
+
+func (e *TeamScanError) Error() string {
+	return fmt.Sprintf("team %s: %v", e.Team, e.Err)
+}
+
+func (e *TeamScanError) Unwrap() error {
+	return e.Err
+}
+
+// FindOrphans lists the datasets labelled with each namespace's team, in the
+// GCP project of the namespace and the projects of its BigQueryDatasets, and
+// returns those not managed by any of the BigQueryDatasets. Namespaces without
+// a project are skipped.
+//
+// A team that fails is left out of the result, and the errors of all such
+// teams are returned joined, each as a *TeamScanError, along with the orphans
+// of the other teams.
+func FindOrphans(ctx context.Context, c client.Reader, bq BigQuery, resolver ProjectResolver) ([]Orphan, error) {
+	var namespaces corev1.NamespaceList
+	if err := c.List(ctx, &namespaces); err != nil {
+		return nil, fmt.Errorf("listing namespaces: %w", err)
+	}
+	var datasets google_nais_io_v1.BigQueryDatasetList
+	if err := c.List(ctx, &datasets); err != nil {
+		return nil, fmt.Errorf("listing BigQueryDatasets: %w", err)
+	}
+
+	type team struct {
+		projects map[string]bool
+		managed  map[Orphan]bool
+	}
+	teams := map[string]*team{}
+	teamOf := func(namespace string) *team {
+		if teams[namespace] == nil {
+			teams[namespace] = &team{projects: map[string]bool{}, managed: map[Orphan]bool{}}
+		}
+		return teams[namespace]
+	}
+	failed := map[string]error{}
+
+	for _, ns := range namespaces.Items {
+		projectID, err := resolver.ResolveProject(ctx, google_nais_io_v1.BigQueryDataset{ObjectMeta: metav1.ObjectMeta{Namespace: ns.Name}})
+		if errors.Is(err, ErrProjectNotFound) {
+			continue
+		} else if err != nil {
+			failed[ns.Name] = fmt.Errorf("resolving GCP project of namespace: %w", err)
+			continue
+		}
+		teamOf(ns.Name).projects[projectID] = true
+	}
+
+	for _, dataset := range datasets.Items {
+		// The recorded project is where the dataset is, even if the namespace
+		// has moved to another project since.
+		projectID, ok := dataset.GetAnnotations()[projectAnnotation]
+		if !ok {
+			var err error
+			projectID, err = resolver.ResolveProject(ctx, dataset)
+			if errors.Is(err, ErrProjectNotFound) {
+				continue
+			} else if err != nil {
+				// Without its project, the dataset would be reported as an
+				// orphan of the team.
+				failed[dataset.Namespace] = fmt.Errorf("resolving GCP project of BigQueryDataset %s: %w", dataset.Name, err)
+				continue
+			}
+		}
+		t := teamOf(dataset.Namespace)
+		t.projects[projectID] = true
+		t.managed[Orphan{Team: dataset.Namespace, ProjectID: projectID, Dataset: dataset.Spec.Name}] = true
+	}
+
+	var orphans []Orphan
+	for namespace, t := range teams {
+		if failed[namespace] != nil {
+			continue
+		}
+		// The namespace lets an impersonating client factory list the
+		// datasets as the team.
+		teamCtx := ContextWithNamespace(ctx, namespace)
+		var teamOrphans []Orphan
+		for projectID := range t.projects {
+			names, err := bq.List(teamCtx, projectID, "labels.team:"+namespace)
+			if err != nil {
+				failed[namespace] = fmt.Errorf("listing datasets in project %s: %w", projectID, err)
+				break
+			}
+			for _, name := range names {
+				orphan := Orphan{Team: namespace, ProjectID: projectID, Dataset: name}
+				if !t.managed[orphan] {
+					teamOrphans = append(teamOrphans, orphan)
+				}
+			}
+		}
+		if failed[namespace] == nil {
+			orphans = append(orphans, teamOrphans...)
+		}
+	}
+
+	sortOrphans(orphans)
+
+	var errs []error
+	for _, namespace := range slices.Sorted(maps.Keys(failed)) {
+		errs = append(errs, &TeamScanError{Team: namespace, Err: failed[namespace]})
+	}
+	return orphans, errors.Join(errs...)
+}
+
+func sortOrphans(orphans []Orphan) {
+	slices.SortFunc(orphans, func(a, b Orphan) int {
+		return cmp.Or(cmp.Compare(a.Team, b.Team), cmp.Compare(a.ProjectID, b.ProjectID), cmp.Compare(a.Dataset, b.Dataset))
+	})
+}
+
+// failedTeams returns the teams of the *TeamScanErrors joined in err, and
+// false if err has other errors, i.e. if no teams were scanned at all.
+func failedTeams(err error) (map[string]bool, bool) {
+	if err == nil {
+		return nil, true
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	failed := map[string]bool{}
+	for _, err := range errs {
+		var teamErr *TeamScanError
+		if !errors.As(err, &teamErr) {
+			return nil, false
+		}
+		failed[teamErr.Team] = true
+	}
+	return failed, true
+}
+
+// OrphanScanner periodically looks for orphaned datasets with FindOrphans. The
+// result of the latest scan is published as metrics, and served as JSON by
+// the scanner's ServeHTTP.
+type OrphanScanner struct {
+	Client   client.Reader
+	BigQuery BigQuery
+	Resolver ProjectResolver
+	Interval time.Duration
+
+	mu          sync.Mutex
+	orphans     []Orphan
+	failedTeams []string
+	scanned     time.Time
+	lastErr     error
+}
+
+var _ http.Handler = &OrphanScanner{}
+
+// NewOrphanScanner returns a scanner that reports an error until its first
+// scan has completed.
+func NewOrphanScanner(c client.Reader, bq BigQuery, resolver ProjectResolver, interval time.Duration) *OrphanScanner {
+	return &OrphanScanner{
+		Client:   c,
+		BigQuery: bq,
+		Resolver: resolver,
+		Interval: interval,
+		lastErr:  errNotScanned,
+	}
+}
+
+// Start scans immediately and then every Interval until ctx is cancelled. It
+// implements manager.Runnable.
+func (s *OrphanScanner) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns true, so that only the leader lists datasets in
+// BigQuery. Other replicas report that they haven't scanned.
+func (s *OrphanScanner) NeedLeaderElection() bool {
+	return true
+}
+
+// orphanReport is the body served by OrphanScanner.
+type orphanReport struct {
+	ScannedAt time.Time `json:"scannedAt"`
+	Orphans   []Orphan  `json:"orphans"`
+	// FailedTeams are the teams that couldn't be scanned. Their orphans are
+	// the ones found by the last scan that succeeded for them.
+	FailedTeams []string `json:"failedTeams,omitempty"`
+}
+
+// ServeHTTP responds with the orphans found by the latest scan, or 503
+// Service Unavailable if no teams have been scanned.
+func (s *OrphanScanner) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	report := orphanReport{ScannedAt: s.scanned, Orphans: s.orphans, FailedTeams: s.failedTeams}
+	err := s.lastErr
+	s.mu.Unlock()
+
+	if report.ScannedAt.IsZero() {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if report.Orphans == nil {
+		report.Orphans = []Orphan{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+}
+
+func (s *OrphanScanner) scan(ctx context.Context) {
+	orphans, err := FindOrphans(ctx, s.Client, s.BigQuery, s.Resolver)
+	failed, partial := failedTeams(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	if err != nil {
+		log.FromContext(ctx).Error(err, "scan for orphaned datasets failed")
+		if !partial {
+			return
+		}
+	}
+
+	// Failed teams keep their orphans from the previous scan, rather than
+	// having them reported as cleaned up.
+	for _, orphan := range s.orphans {
+		if failed[orphan.Team] {
+			orphans = append(orphans, orphan)
+		}
+	}
+	sortOrphans(orphans)
+	s.orphans = orphans
+	s.failedTeams = slices.Sorted(maps.Keys(failed))
+	s.scanned = time.Now()
+
+	// Reset first, so that teams without orphans any more aren't reported.
+	metrics.OrphanedDatasets.Reset()
+	for _, orphan := range orphans {
+		metrics.OrphanedDatasets.WithLabelValues(orphan.Team, orphan.ProjectID).Inc()
+	}
+	if err == nil {
+		metrics.OrphanScanLastSuccess.SetToCurrentTime()
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/nais/bqrator/pkg/metrics"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOrphanScanner(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := func(name, project string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if project != "" {
+			ns.Labels = map[string]string{namespaceProjectLabel: project}
+		}
+		return ns
+	}
+	dataset := func(namespace, name, project string) *naisv1.BigQueryDataset {
+		d := &naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       naisv1.BigQueryDatasetSpec{Name: name},
+		}
+		if project != "" {
+			d.Annotations = map[string]string{projectAnnotation: project}
+		}
+		return d
+	}
+
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		namespace("a", "proj-a"),
+		namespace("b", "proj-b"),
+		namespace("unlabelled", ""),
+		dataset("a", "managed", ""),
+		// Synchronized before the namespace moved to proj-b.
+		dataset("b", "moved", "proj-old"),
+	).Build()
+
+	_, fakeBQ := newFakeBigQuery(t)
+	bq := &teamFailingBigQuery{BigQuery: fakeBQ}
+	for _, ds := range []struct{ project, name, team string }{
+		{"proj-a", "managed", "a"},
+		{"proj-a", "orphan", "a"},
+		{"proj-a", "other_team", "b"},
+		{"proj-a", "unlabelled", ""},
+		{"proj-b", "renamed", "b"},
+		{"proj-old", "moved", "b"},
+		{"proj-old", "left_behind", "b"},
+	} {
+		md := &bigquery.DatasetMetadata{Name: ds.name}
+		if ds.team != "" {
+			md.Labels = map[string]string{"team": ds.team}
+		}
+		if err := bq.Create(ctx, ds.project, md); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := NewOrphanScanner(c, bq, NewNamespaceProjectResolver(c), time.Hour)
+
+	rec := httptest.NewRecorder()
+	scanner.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orphans", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before the first scan, got %d", rec.Code)
+	}
+
+	scanner.scan(ctx)
+
+	expected := []Orphan{
+		{Team: "a", ProjectID: "proj-a", Dataset: "orphan"},
+		{Team: "b", ProjectID: "proj-b", Dataset: "renamed"},
+		{Team: "b", ProjectID: "proj-old", Dataset: "left_behind"},
+	}
+	rec = httptest.NewRecorder()
+	scanner.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orphans", nil))
+	var report orphanReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("unexpected report %q: %v", rec.Body, err)
+	}
+	if diff := cmp.Diff(expected, report.Orphans); diff != "" {
+		t.Errorf("unexpected orphans (-want +got):\n%s", diff)
+	}
+	if got := testutil.ToFloat64(metrics.OrphanedDatasets.WithLabelValues("b", "proj-old")); got != 1 {
+		t.Errorf("expected 1 orphan for team b in proj-old, got %v", got)
+	}
+
+	for _, call := range bq.calls {
+		if call.filter != "labels.team:"+call.namespace {
+			t.Errorf("expected datasets to be listed in the namespace of the team, got %q in namespace %q", call.filter, call.namespace)
+		}
+	}
+
+	if err := bq.Delete(ctx, "proj-old", "left_behind"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bq.Delete(ctx, "proj-a", "orphan"); err != nil {
+		t.Fatal(err)
+	}
+	bq.failTeam = "b"
+	scanner.scan(ctx)
+
+	rec = httptest.NewRecorder()
+	scanner.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orphans", nil))
+	report = orphanReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("unexpected report %q: %v", rec.Body, err)
+	}
+	// Team a is scanned, while team b keeps its orphans from the previous scan.
+	expected = []Orphan{
+		{Team: "b", ProjectID: "proj-b", Dataset: "renamed"},
+		{Team: "b", ProjectID: "proj-old", Dataset: "left_behind"},
+	}
+	if diff := cmp.Diff(expected, report.Orphans); diff != "" {
+		t.Errorf("unexpected orphans with a failed team (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"b"}, report.FailedTeams); diff != "" {
+		t.Errorf("unexpected failed teams (-want +got):\n%s", diff)
+	}
+	if got := testutil.ToFloat64(metrics.OrphanedDatasets.WithLabelValues("b", "proj-old")); got != 1 {
+		t.Errorf("expected orphan of failed team to still be reported, got %v", got)
+	}
+
+	bq.failTeam = ""
+	scanner.scan(ctx)
+	if got := testutil.CollectAndCount(metrics.OrphanedDatasets); got != 1 {
+		t.Errorf("expected orphans cleaned up to no longer be reported, got %d series", got)
+	}
+}
+
+// teamFailingBigQuery fails to list the datasets of failTeam, and records the
+// namespace in the context of each List call.
+type teamFailingBigQuery struct {
+	BigQuery
+	failTeam string
+	calls    []listCall
+}
+
+type listCall struct {
+	namespace string
+	filter    string
+}
+
+func (b *teamFailingBigQuery) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	namespace, _ := NamespaceFromContext(ctx)
+	b.calls = append(b.calls, listCall{namespace: namespace, filter: filter})
+	if b.failTeam != "" && filter == "labels.team:"+b.failTeam {
+		return nil, errors.New("permission denied")
+	}
+	return b.BigQuery.List(ctx, projectID, filter)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/bigquery"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"google.golang.org/api/googleapi"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanUpdate PlanAction = "update"
+	PlanNone   PlanAction = "none"
+)
+
+// Plan describes what the reconciler would do to bring a dataset in BigQuery
+// in line with its BigQueryDataset.
+type Plan struct {
+	Action    PlanAction
+	ProjectID string
+	Name      string
+	// Changes has one line per change, such as `description "a" -> "b"` or
+	// "add READER user:foo@example.com", followed by the access entries that
+	// are kept.
+	Changes []string
+}
+
+// PlanDataset fetches the dataset from BigQuery in projectID, and returns the
+// changes the reconciler would make to it, using ownerEmail as the operator's
+// own identity. It makes no changes.
+func PlanDataset(ctx context.Context, bq BigQuery, dataset google_nais_io_v1.BigQueryDataset, projectID, ownerEmail string) (Plan, error) {
+	plan := Plan{ProjectID: projectID, Name: dataset.Spec.Name}
+
+	existing, err := bq.Get(ctx, projectID, dataset.Spec.Name)
+	if gerr := (*googleapi.Error)(nil); errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		access := ensureBQratorOwner(createAccessList(dataset), ownerEmail)
+		plan.Action = PlanCreate
+		plan.Changes = diffDataset(dataset, &bigquery.DatasetMetadata{}, access).changes()
+		return plan, nil
+	} else if err != nil {
+		return Plan{}, err
+	}
+
+	access := mergeAccess(createAccessList(dataset), existing.Access, ownerEmail)
+	plan.Action = PlanUpdate
+	if metadataEqual(dataset, existing, access) {
+		plan.Action = PlanNone
+	}
+	plan.Changes = diffDataset(dataset, existing, access).changes()
+	return plan, nil
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nais/bqrator/pkg/config"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrProjectNotFound is returned by a ProjectResolver that can't find a GCP
+// project for a dataset.
+var ErrProjectNotFound = errors.New("unable to find GCP project")
+
+// ProjectResolver resolves the GCP project a BigQueryDataset is created in.
+type ProjectResolver interface {
+	ResolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error)
+}
+
+// NewProjectResolver builds the chain of project resolvers configured by cfg.
+// spec.project is honoured first for allowed namespaces, then the ConfigMap
+// mapping, and last the namespace labels and annotations. A cached c should
+// have its ConfigMaps restricted by ProjectMapCacheOptions, so that only the
+// one ConfigMap needs to be readable.
+func NewProjectResolver(c client.Reader, cfg config.ProjectConfig) ProjectResolver {
+	var chain ProjectResolverChain
+	if len(cfg.SpecProjectNamespaces) > 0 {
+		chain = append(chain, &SpecProjectResolver{AllowedNamespaces: cfg.SpecProjectNamespaces})
+	}
+
+	if cfg.MapConfigMap != "" {
+		namespace, name, _ := strings.Cut(cfg.MapConfigMap, "/")
+		chain = append(chain, &ConfigMapProjectResolver{
+			Reader: c,
+			Key:    types.NamespacedName{Namespace: namespace, Name: name},
+		})
+	}
+
+	return append(chain, &NamespaceProjectResolver{
+		Client:         c,
+		LabelKeys:      cfg.LabelKeys,
+		AnnotationKeys: cfg.AnnotationKeys,
+	})
+}
+
+// namespaceMetadataReader is implemented by resolvers that read the project
+// from namespace metadata, so that the namespace watch knows which label and
+// annotation changes should trigger reconciliation.
+type namespaceMetadataReader interface {
+	namespaceKeys() (labels, annotations []string)
+}
+
+// NamespaceProjectResolver reads the project from the first of LabelKeys, and
+// then AnnotationKeys, that is set on the dataset's namespace.
+type NamespaceProjectResolver struct {
+	Client         client.Reader
+	LabelKeys      []string
+	AnnotationKeys []string
+}
+
+var (
+	_ ProjectResolver         = &NamespaceProjectResolver{}
+	_ namespaceMetadataReader = &NamespaceProjectResolver{}
+)
+
+// NewNamespaceProjectResolver returns a NamespaceProjectResolver using the NAIS
+// conventions for where the project is stored on the namespace.
+func NewNamespaceProjectResolver(c client.Reader) *NamespaceProjectResolver {
+	return &NamespaceProjectResolver{
+		Client:         c,
+		LabelKeys:      []string{namespaceProjectLabel},
+		AnnotationKeys: []string{namespaceProjectAnnotation},
+	}
+}
+
+func (n *NamespaceProjectResolver) ResolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	ns := &corev1.Namespace{}
+	if err := n.Client.Get(ctx, types.NamespacedName{Name: dataset.Namespace}, ns); err != nil {
+		return "", err
+	}
+
+	for _, key := range n.LabelKeys {
+		if projectID, ok := ns.Labels[key]; ok {
+			return projectID, nil
+		}
+	}
+	for _, key := range n.AnnotationKeys {
+		if projectID, ok := ns.Annotations[key]; ok {
+			return projectID, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: none of the labels %v or annotations %v are set on namespace %s", ErrProjectNotFound, n.LabelKeys, n.AnnotationKeys, ns.Name)
+}
+
+func (n *NamespaceProjectResolver) namespaceKeys() ([]string, []string) {
+	return n.LabelKeys, n.AnnotationKeys
+}
+
+// StaticProjectResolver looks up the project in a fixed namespace to project
+// mapping.
+type StaticProjectResolver struct {
+	Projects map[string]string
+}
+
+var _ ProjectResolver = &StaticProjectResolver{}
+
+func (s *StaticProjectResolver) ResolveProject(_ context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	projectID, ok := s.Projects[dataset.Namespace]
+	if !ok {
+		return "", fmt.Errorf("%w: namespace %s is not in the project mapping", ErrProjectNotFound, dataset.Namespace)
+	}
+	return projectID, nil
+}
+
+// ConfigMapProjectResolver looks up the project in the namespace to project
+// mapping of a ConfigMap. The ConfigMap is read on every lookup, so that
+// changes to it apply from the next reconcile without restarting bqrator.
+// Reader should be a cache, see ProjectMapCacheOptions, so that lookups don't
+// reach the API server.
+type ConfigMapProjectResolver struct {
+	Reader client.Reader
+	Key    types.NamespacedName
+}
+
+var _ ProjectResolver = &ConfigMapProjectResolver{}
+
+// ProjectMapCacheOptions restricts the ConfigMaps in opts to the project map
+// ConfigMap of cfg, if it is set, so that the cache only lists and watches the
+// one ConfigMap.
+func ProjectMapCacheOptions(opts cache.Options, cfg config.ProjectConfig) cache.Options {
+	namespace, name, ok := strings.Cut(cfg.MapConfigMap, "/")
+	if !ok {
+		return opts
+	}
+	if opts.ByObject == nil {
+		opts.ByObject = map[client.Object]cache.ByObject{}
+	}
+	opts.ByObject[&corev1.ConfigMap{}] = cache.ByObject{
+		Namespaces: map[string]cache.Config{namespace: {}},
+		Field:      fields.OneTermEqualSelector("metadata.name", name),
+	}
+	return opts
+}
+
+func (c *ConfigMapProjectResolver) ResolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := c.Reader.Get(ctx, c.Key, cm); err != nil {
+		return "", fmt.Errorf("reading project map ConfigMap %s: %w", c.Key, err)
+	}
+	return (&StaticProjectResolver{Projects: cm.Data}).ResolveProject(ctx, dataset)
+}
+
+// SpecProjectResolver honours spec.project for datasets in AllowedNamespaces.
+// An allowed namespace of "*" allows every namespace.
+type SpecProjectResolver struct {
+	AllowedNamespaces []string
+}
+
+var _ ProjectResolver = &SpecProjectResolver{}
+
+func (s *SpecProjectResolver) ResolveProject(_ context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	if dataset.Spec.Project == "" {
+		return "", fmt.Errorf("%w: spec.project is not set", ErrProjectNotFound)
+	}
+	if !slices.Contains(s.AllowedNamespaces, dataset.Namespace) && !slices.Contains(s.AllowedNamespaces, "*") {
+		return "", fmt.Errorf("%w: namespace %s is not allowed to set spec.project", ErrProjectNotFound, dataset.Namespace)
+	}
+	return dataset.Spec.Project, nil
+}
+
+// RecordedProjectResolver returns the project recorded by the reconciler in
+// the bqrator.nais.io/project-id annotation, which it keeps using even if the
+// project would resolve differently. The annotation is read from the dataset,
+// or else from the BigQueryDataset of the same name in the cluster. Datasets
+// without a recorded project are resolved with Resolver.
+type RecordedProjectResolver struct {
+	Reader   client.Reader
+	Resolver ProjectResolver
+}
+
+var _ ProjectResolver = &RecordedProjectResolver{}
+
+func (r *RecordedProjectResolver) ResolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	if projectID, ok := dataset.GetAnnotations()[projectAnnotation]; ok {
+		return projectID, nil
+	}
+
+	existing := &google_nais_io_v1.BigQueryDataset{}
+	err := r.Reader.Get(ctx, client.ObjectKeyFromObject(&dataset), existing)
+	if client.IgnoreNotFound(err) != nil {
+		return "", err
+	}
+	if projectID, ok := existing.GetAnnotations()[projectAnnotation]; err == nil && ok {
+		return projectID, nil
+	}
+	return r.Resolver.ResolveProject(ctx, dataset)
+}
+
+// ProjectResolverChain tries each resolver in order, and returns the first
+// project found. Errors other than ErrProjectNotFound stop the chain.
+type ProjectResolverChain []ProjectResolver
+
+var (
+	_ ProjectResolver         = ProjectResolverChain{}
+	_ namespaceMetadataReader = ProjectResolverChain{}
+)
+
+func (c ProjectResolverChain) ResolveProject(ctx context.Context, dataset google_nais_io_v1.BigQueryDataset) (string, error) {
+	var errs []error
+	for _, resolver := range c {
+		projectID, err := resolver.ResolveProject(ctx, dataset)
+		if err == nil {
+			return projectID, nil
+		}
+		if !errors.Is(err, ErrProjectNotFound) {
+			return "", err
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return "", ErrProjectNotFound
+	}
+	return "", errors.Join(errs...)
+}
+
+func (c ProjectResolverChain) namespaceKeys() ([]string, []string) {
+	var labels, annotations []string
+	for _, resolver := range c {
+		if reader, ok := resolver.(namespaceMetadataReader); ok {
+			l, a := reader.namespaceKeys()
+			labels = append(labels, l...)
+			annotations = append(annotations, a...)
+		}
+	}
+	return labels, annotations
+}
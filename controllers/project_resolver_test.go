@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nais/bqrator/pkg/config"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestProjectResolvers(t *testing.T) {
+	ctx := context.Background()
+
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "labelled",
+			Labels: map[string]string{"google-cloud-project": "label-project", "custom": "custom-project"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "annotated",
+			Annotations: map[string]string{"cnrm.cloud.google.com/project-id": "annotation-project"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "bare",
+		}},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "bqrator", Name: "projects"},
+			Data:       map[string]string{"bare": "configmap-project"},
+		},
+	).Build()
+
+	datasetIn := func(namespace, specProject string) naisv1.BigQueryDataset {
+		return naisv1.BigQueryDataset{
+			ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: namespace},
+			Spec:       naisv1.BigQueryDatasetSpec{Name: "ds", Project: specProject},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		resolver  ProjectResolver
+		dataset   naisv1.BigQueryDataset
+		expected  string
+		expectErr error
+	}{
+		{
+			name:     "namespace label",
+			resolver: NewNamespaceProjectResolver(c),
+			dataset:  datasetIn("labelled", ""),
+			expected: "label-project",
+		},
+		{
+			name:     "namespace annotation",
+			resolver: NewNamespaceProjectResolver(c),
+			dataset:  datasetIn("annotated", ""),
+			expected: "annotation-project",
+		},
+		{
+			name:      "namespace without project",
+			resolver:  NewNamespaceProjectResolver(c),
+			dataset:   datasetIn("bare", ""),
+			expectErr: ErrProjectNotFound,
+		},
+		{
+			name:     "custom namespace label",
+			resolver: &NamespaceProjectResolver{Client: c, LabelKeys: []string{"custom"}},
+			dataset:  datasetIn("labelled", ""),
+			expected: "custom-project",
+		},
+		{
+			name:     "static mapping",
+			resolver: &StaticProjectResolver{Projects: map[string]string{"bare": "static-project"}},
+			dataset:  datasetIn("bare", ""),
+			expected: "static-project",
+		},
+		{
+			name:     "configmap mapping",
+			resolver: &ConfigMapProjectResolver{Reader: c, Key: types.NamespacedName{Namespace: "bqrator", Name: "projects"}},
+			dataset:  datasetIn("bare", ""),
+			expected: "configmap-project",
+		},
+		{
+			name:      "namespace not in configmap mapping",
+			resolver:  &ConfigMapProjectResolver{Reader: c, Key: types.NamespacedName{Namespace: "bqrator", Name: "projects"}},
+			dataset:   datasetIn("labelled", ""),
+			expectErr: ErrProjectNotFound,
+		},
+		{
+			name:      "missing configmap",
+			resolver:  &ConfigMapProjectResolver{Reader: c, Key: types.NamespacedName{Namespace: "bqrator", Name: "missing"}},
+			dataset:   datasetIn("bare", ""),
+			expectErr: errors.New("not found"),
+		},
+		{
+			name:     "spec project in allowed namespace",
+			resolver: &SpecProjectResolver{AllowedNamespaces: []string{"bare"}},
+			dataset:  datasetIn("bare", "spec-project"),
+			expected: "spec-project",
+		},
+		{
+			name:      "spec project in disallowed namespace",
+			resolver:  &SpecProjectResolver{AllowedNamespaces: []string{"other"}},
+			dataset:   datasetIn("bare", "spec-project"),
+			expectErr: ErrProjectNotFound,
+		},
+		{
+			name: "chain falls through to namespace",
+			resolver: ProjectResolverChain{
+				&SpecProjectResolver{AllowedNamespaces: []string{"other"}},
+				&StaticProjectResolver{Projects: map[string]string{}},
+				NewNamespaceProjectResolver(c),
+			},
+			dataset:  datasetIn("labelled", "spec-project"),
+			expected: "label-project",
+		},
+		{
+			name: "chain prefers earlier resolvers",
+			resolver: ProjectResolverChain{
+				&SpecProjectResolver{AllowedNamespaces: []string{"*"}},
+				NewNamespaceProjectResolver(c),
+			},
+			dataset:  datasetIn("labelled", "spec-project"),
+			expected: "spec-project",
+		},
+		{
+			name: "chain stops on other errors",
+			resolver: ProjectResolverChain{
+				NewNamespaceProjectResolver(c),
+				&StaticProjectResolver{Projects: map[string]string{"missing": "static-project"}},
+			},
+			dataset:   datasetIn("missing", ""),
+			expectErr: errors.New("not found"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectID, err := tt.resolver.ResolveProject(ctx, tt.dataset)
+			switch {
+			case tt.expectErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.expectErr != nil && err == nil:
+				t.Fatalf("expected error, got project %q", projectID)
+			case errors.Is(tt.expectErr, ErrProjectNotFound) && !errors.Is(err, ErrProjectNotFound):
+				t.Fatalf("expected ErrProjectNotFound, got %v", err)
+			}
+			if projectID != tt.expected {
+				t.Errorf("expected project %q, got %q", tt.expected, projectID)
+			}
+		})
+	}
+}
+
+func TestProjectMapCacheOptions(t *testing.T) {
+	opts := ProjectMapCacheOptions(cache.Options{}, config.ProjectConfig{})
+	if len(opts.ByObject) > 0 {
+		t.Errorf("expected no ConfigMap restriction without a project map, got %v", opts.ByObject)
+	}
+
+	opts = ProjectMapCacheOptions(Shard{}.CacheOptions(), config.ProjectConfig{MapConfigMap: "bqrator/projects"})
+	var byObject cache.ByObject
+	for obj, o := range opts.ByObject {
+		if _, ok := obj.(*corev1.ConfigMap); ok {
+			byObject = o
+		}
+	}
+	if _, ok := byObject.Namespaces["bqrator"]; !ok || len(byObject.Namespaces) != 1 {
+		t.Errorf("expected ConfigMaps to be cached from namespace bqrator only, got %v", byObject.Namespaces)
+	}
+	if byObject.Field == nil || byObject.Field.String() != "metadata.name=projects" {
+		t.Errorf("expected ConfigMaps to be selected by name, got %v", byObject.Field)
+	}
+}
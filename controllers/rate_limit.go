@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/config"
+	"github.com/nais/bqrator/pkg/metrics"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RateLimitedBigQuery limits the rate of calls to the wrapped BigQuery
+// implementation with a token bucket shared by all projects. Calls wait for a
+// token until their context is cancelled.
+type RateLimitedBigQuery struct {
+	BigQuery BigQuery
+	Limiter  *rate.Limiter
+}
+
+var _ BigQuery = &RateLimitedBigQuery{}
+
+func NewRateLimitedBigQuery(bq BigQuery, qps float64, burst int) *RateLimitedBigQuery {
+	return &RateLimitedBigQuery{
+		BigQuery: bq,
+		Limiter:  rate.NewLimiter(rate.Limit(qps), burst),
+	}
+}
+
+func (r *RateLimitedBigQuery) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
+	if err := r.wait(ctx, "get"); err != nil {
+		return nil, err
+	}
+	return r.BigQuery.Get(ctx, projectID, name)
+}
+
+func (r *RateLimitedBigQuery) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
+	if err := r.wait(ctx, "create"); err != nil {
+		return err
+	}
+	return r.BigQuery.Create(ctx, projectID, dataset)
+}
+
+func (r *RateLimitedBigQuery) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error {
+	if err := r.wait(ctx, "update"); err != nil {
+		return err
+	}
+	return r.BigQuery.Update(ctx, projectID, name, dataset, etag)
+}
+
+func (r *RateLimitedBigQuery) Delete(ctx context.Context, projectID, name string) error {
+	if err := r.wait(ctx, "delete"); err != nil {
+		return err
+	}
+	return r.BigQuery.Delete(ctx, projectID, name)
+}
+
+func (r *RateLimitedBigQuery) List(ctx context.Context, projectID, filter string) ([]string, error) {
+	if err := r.wait(ctx, "list"); err != nil {
+		return nil, err
+	}
+	return r.BigQuery.List(ctx, projectID, filter)
+}
+
+func (r *RateLimitedBigQuery) wait(ctx context.Context, operation string) error {
+	if r.Limiter.Allow() {
+		return nil
+	}
+
+	metrics.BigQueryThrottled.WithLabelValues(operation).Inc()
+	metrics.BigQueryRateLimitWaiting.Inc()
+	defer metrics.BigQueryRateLimitWaiting.Dec()
+
+	start := time.Now()
+	err := r.Limiter.Wait(ctx)
+	metrics.BigQueryRateLimitWait.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// newRequeueRateLimiter returns the rate limiter for the controller's work
+// queue: the slower of a per-dataset exponential backoff and a token bucket
+// shared by all datasets, as in controller-runtime's default, but with
+// configurable limits.
+func newRequeueRateLimiter(cfg config.RateLimitConfig) workqueue.TypedRateLimiter[reconcile.Request] {
+	return &requeueMetricsRateLimiter{
+		TypedRateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](cfg.RequeueBaseDelay.Duration, cfg.RequeueMaxDelay.Duration),
+			&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(cfg.RequeueQPS), cfg.RequeueBurst)},
+		),
+	}
+}
+
+// requeueMetricsRateLimiter records the delays given to rate limited requeues.
+type requeueMetricsRateLimiter struct {
+	workqueue.TypedRateLimiter[reconcile.Request]
+}
+
+func (r *requeueMetricsRateLimiter) When(item reconcile.Request) time.Duration {
+	delay := r.TypedRateLimiter.When(item)
+	metrics.RequeueDelay.Observe(delay.Seconds())
+	return delay
+}
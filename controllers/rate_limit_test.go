@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestRateLimitedBigQuery(t *testing.T) {
+	server, bq := newFakeBigQuery(t)
+	limited := NewRateLimitedBigQuery(bq, 1, 1)
+
+	t.Run("calls within burst pass through", func(t *testing.T) {
+		if err := limited.Create(context.Background(), "proj", &bigquery.DatasetMetadata{Name: "limited"}); err != nil {
+			t.Fatal(err)
+		}
+		if !server.HasDataset("proj", "limited") {
+			t.Error("expected dataset to be created")
+		}
+	})
+
+	t.Run("throttled call gives up when context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		// The limiter fails immediately when the wait would exceed the deadline
+		if _, err := limited.Get(ctx, "proj", "limited"); err == nil {
+			t.Fatal("expected throttled call to fail")
+		}
+	})
+}
+
+func TestRequeueRateLimiter(t *testing.T) {
+	cfg := config.Default().RateLimit
+	cfg.RequeueBaseDelay.Duration = time.Second
+	cfg.RequeueMaxDelay.Duration = 4 * time.Second
+	limiter := newRequeueRateLimiter(cfg)
+
+	item := reconcile.Request{}
+	item.Name = "dataset"
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, w := range want {
+		if got := limiter.When(item); got != w {
+			t.Errorf("requeue %d: expected delay %v, got %v", i, w, got)
+		}
+	}
+
+	limiter.Forget(item)
+	if got := limiter.When(item); got != time.Second {
+		t.Errorf("expected delay to reset after Forget, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nais/bqrator/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var errNotChecked = errors.New("connectivity has not been checked yet")
+
+// ReadinessChecker periodically runs Check, and reports the result of the
+// latest run as the readiness of the operator. Checks run in the background so
+// that probes are cheap and don't depend on BigQuery's latency.
+type ReadinessChecker struct {
+	Check    func(ctx context.Context) error
+	Interval time.Duration
+	Timeout  time.Duration
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewReadinessChecker returns a checker that isn't ready until check has
+// succeeded once.
+func NewReadinessChecker(check func(ctx context.Context) error, interval, timeout time.Duration) *ReadinessChecker {
+	return &ReadinessChecker{
+		Check:    check,
+		Interval: interval,
+		Timeout:  timeout,
+		lastErr:  errNotChecked,
+	}
+}
+
+// Start runs the check immediately and then every Interval until ctx is
+// cancelled. It implements manager.Runnable.
+func (c *ReadinessChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false, since every replica must check its own
+// connectivity to report readiness.
+func (c *ReadinessChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// Checker returns the result of the latest check. It has the signature of a
+// healthz.Checker.
+func (c *ReadinessChecker) Checker(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErr
+}
+
+func (c *ReadinessChecker) run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	err := c.Check(ctx)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "BigQuery connectivity check failed")
+	} else {
+		metrics.ReadinessLastSuccess.SetToCurrentTime()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nais/bqrator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+func TestReadinessChecker(t *testing.T) {
+	ctx := context.Background()
+
+	var checkErr error
+	checker := NewReadinessChecker(func(context.Context) error { return checkErr }, time.Minute, time.Second)
+
+	if err := checker.Checker(nil); err == nil {
+		t.Error("expected checker not to be ready before the first check")
+	}
+
+	checkErr = errors.New("invalid_grant")
+	checker.run(ctx)
+	if err := checker.Checker(nil); !errors.Is(err, checkErr) {
+		t.Errorf("expected failed check to be reported, got %v", err)
+	}
+
+	checkErr = nil
+	checker.run(ctx)
+	if err := checker.Checker(nil); err != nil {
+		t.Errorf("expected checker to be ready, got %v", err)
+	}
+	if testutil.ToFloat64(metrics.ReadinessLastSuccess) == 0 {
+		t.Error("expected time of last successful check to be recorded")
+	}
+}
+
+func TestClientPoolPing(t *testing.T) {
+	ctx := context.Background()
+
+	var path string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"datasets": []}`))
+		} else {
+			_, _ = w.Write([]byte(`{"error": {"code": 403, "message": "Access denied"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	pool := &ClientPool{
+		TokenSource:   oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		ClientOptions: []option.ClientOption{option.WithEndpoint(srv.URL)},
+	}
+
+	t.Run("token only", func(t *testing.T) {
+		if err := pool.Ping(ctx, ""); err != nil {
+			t.Fatal(err)
+		}
+		if path != "" {
+			t.Errorf("expected no BigQuery call, got request to %s", path)
+		}
+	})
+
+	t.Run("lists datasets", func(t *testing.T) {
+		if err := pool.Ping(ctx, "proj"); err != nil {
+			t.Fatal(err)
+		}
+		if path != "/projects/proj/datasets" {
+			t.Errorf("unexpected request to %s", path)
+		}
+	})
+
+	t.Run("acquires a new token", func(t *testing.T) {
+		refreshed := 0
+		pool.NewTokenSource = func(context.Context) (oauth2.TokenSource, error) {
+			refreshed++
+			return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "new-token"}), nil
+		}
+		defer func() { pool.NewTokenSource = nil }()
+
+		for range 2 {
+			if err := pool.Ping(ctx, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if refreshed != 2 {
+			t.Errorf("expected a new token source per ping, got %d", refreshed)
+		}
+	})
+
+	t.Run("gives up when context is done", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+		pool.NewTokenSource = func(context.Context) (oauth2.TokenSource, error) {
+			return blockingTokenSource(block), nil
+		}
+		defer func() { pool.NewTokenSource = nil }()
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := pool.Ping(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline to be exceeded, got %v", err)
+		}
+	})
+
+	t.Run("reports access errors", func(t *testing.T) {
+		status = http.StatusForbidden
+		if err := pool.Ping(ctx, "proj"); err == nil {
+			t.Error("expected error when listing is denied")
+		}
+	})
+}
+
+// blockingTokenSource returns a token once block is closed.
+type blockingTokenSource chan struct{}
+
+func (b blockingTokenSource) Token() (*oauth2.Token, error) {
+	<-b
+	return &oauth2.Token{AccessToken: "token"}, nil
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nais/bqrator/pkg/config"
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Shard is the part of the cluster an instance of bqrator is responsible for.
+// The zero value is the whole cluster.
+type Shard struct {
+	// Namespaces are the only namespaces in the shard, or empty for all.
+	Namespaces []string
+	// NamespaceSelector selects the namespaces in the shard, or nil for all.
+	NamespaceSelector labels.Selector
+	// DatasetSelector selects the BigQueryDatasets in the shard, or nil for
+	// all.
+	DatasetSelector labels.Selector
+	// ScanOrphans designates the shard to scan for orphans among those with a
+	// DatasetSelector.
+	ScanOrphans bool
+}
+
+// NewShard returns the shard described by cfg, which must be valid.
+func NewShard(cfg config.ShardingConfig) (Shard, error) {
+	shard := Shard{Namespaces: cfg.Namespaces, ScanOrphans: cfg.ScanOrphans}
+	if cfg.NamespaceSelector != "" {
+		selector, err := labels.Parse(cfg.NamespaceSelector)
+		if err != nil {
+			return Shard{}, err
+		}
+		shard.NamespaceSelector = selector
+	}
+	if cfg.DatasetSelector != "" {
+		selector, err := labels.Parse(cfg.DatasetSelector)
+		if err != nil {
+			return Shard{}, err
+		}
+		shard.DatasetSelector = selector
+	}
+	return shard, nil
+}
+
+// ScansOrphans reports whether the shard scans for orphans. Shards with a
+// DatasetSelector share namespaces with other shards, so only the one
+// designated by ScanOrphans scans, rather than every such shard reporting the
+// same orphans.
+func (s Shard) ScansOrphans() bool {
+	return s.DatasetSelector == nil || s.ScanOrphans
+}
+
+// CacheOptions restricts the manager's cache to the shard. Namespaces are
+// cached by selector, but the BigQueryDatasets of namespaces outside the
+// shard are still cached, as their namespace labels can't be selected on.
+func (s Shard) CacheOptions() cache.Options {
+	var opts cache.Options
+	if len(s.Namespaces) > 0 {
+		opts.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range s.Namespaces {
+			opts.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	opts.ByObject = map[client.Object]cache.ByObject{}
+	if s.NamespaceSelector != nil {
+		opts.ByObject[&corev1.Namespace{}] = cache.ByObject{Label: s.NamespaceSelector}
+	}
+	if s.DatasetSelector != nil {
+		opts.ByObject[&google_nais_io_v1.BigQueryDataset{}] = cache.ByObject{Label: s.DatasetSelector}
+	}
+	return opts
+}
+
+// containsNamespace reports whether the namespace is in the shard.
+func (s Shard) containsNamespace(ns corev1.Namespace) bool {
+	if len(s.Namespaces) > 0 && !slices.Contains(s.Namespaces, ns.Name) {
+		return false
+	}
+	return s.NamespaceSelector == nil || s.NamespaceSelector.Matches(labels.Set(ns.Labels))
+}
+
+// inShard reports whether the dataset's namespace is in the shard. The dataset
+// is assumed to be read from the cache, and so to match DatasetSelector and
+// be in one of Namespaces.
+func (s Shard) inShard(ctx context.Context, c client.Reader, dataset google_nais_io_v1.BigQueryDataset) (bool, error) {
+	if s.NamespaceSelector == nil {
+		return true, nil
+	}
+
+	ns := corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: dataset.Namespace}, &ns); err != nil {
+		// Namespaces that don't match the selector aren't in the cache.
+		return false, client.IgnoreNotFound(err)
+	}
+	return s.containsNamespace(ns), nil
+}
+
+// Reader returns a reader that leaves namespaces outside the shard, and the
+// BigQueryDatasets in them, out of lists. BigQueryDatasets are not filtered
+// by DatasetSelector, so that a reader of all datasets in the shard's
+// namespaces, e.g. for the orphan scan, can be had from an uncached reader.
+func (s Shard) Reader(r client.Reader) client.Reader {
+	if s.NamespaceSelector == nil && len(s.Namespaces) == 0 {
+		return r
+	}
+	return &shardReader{Reader: r, shard: s}
+}
+
+type shardReader struct {
+	client.Reader
+	shard Shard
+}
+
+func (r *shardReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := r.Reader.List(ctx, list, opts...); err != nil {
+		return err
+	}
+
+	switch list := list.(type) {
+	case *corev1.NamespaceList:
+		list.Items = slices.DeleteFunc(list.Items, func(ns corev1.Namespace) bool {
+			return !r.shard.containsNamespace(ns)
+		})
+	case *google_nais_io_v1.BigQueryDatasetList:
+		var namespaces corev1.NamespaceList
+		if err := r.List(ctx, &namespaces); err != nil {
+			return err
+		}
+		inShard := map[string]bool{}
+		for _, ns := range namespaces.Items {
+			inShard[ns.Name] = true
+		}
+		list.Items = slices.DeleteFunc(list.Items, func(dataset google_nais_io_v1.BigQueryDataset) bool {
+			return !inShard[dataset.Namespace]
+		})
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nais/bqrator/pkg/config"
+	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestShard(t *testing.T) {
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := naisv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := func(name, shard string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"shard": shard, namespaceProjectLabel: "proj"},
+		}}
+	}
+	dataset := func(namespace string) *naisv1.BigQueryDataset {
+		return &naisv1.BigQueryDataset{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "ds"}}
+	}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		namespace("a1", "a"),
+		namespace("a2", "a"),
+		namespace("b1", "b"),
+		dataset("a1"),
+		dataset("a2"),
+		dataset("b1"),
+	).Build()
+
+	datasetNamespaces := func(t *testing.T, r client.Reader) []string {
+		t.Helper()
+		var datasets naisv1.BigQueryDatasetList
+		if err := r.List(ctx, &datasets); err != nil {
+			t.Fatal(err)
+		}
+		var namespaces []string
+		for _, d := range datasets.Items {
+			namespaces = append(namespaces, d.Namespace)
+		}
+		slices.Sort(namespaces)
+		return namespaces
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.ShardingConfig
+		expected []string
+	}{
+		{name: "whole cluster", expected: []string{"a1", "a2", "b1"}},
+		{name: "namespace selector", cfg: config.ShardingConfig{NamespaceSelector: "shard=a"}, expected: []string{"a1", "a2"}},
+		{name: "namespaces", cfg: config.ShardingConfig{Namespaces: []string{"a2", "b1"}}, expected: []string{"a2", "b1"}},
+		{name: "both", cfg: config.ShardingConfig{Namespaces: []string{"a2", "b1"}, NamespaceSelector: "shard=a"}, expected: []string{"a2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shard, err := NewShard(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := datasetNamespaces(t, shard.Reader(c)); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected datasets in %v, got %v", tt.expected, got)
+			}
+
+			if tt.cfg.NamespaceSelector == "" {
+				return
+			}
+			for _, ns := range []string{"a1", "b1"} {
+				in, err := shard.inShard(ctx, c, *dataset(ns))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := slices.Contains(tt.expected, ns); in != want {
+					t.Errorf("inShard(%s) = %v, want %v", ns, in, want)
+				}
+			}
+		})
+	}
+
+	t.Run("only the designated dataset selector shard scans for orphans", func(t *testing.T) {
+		for _, tt := range []struct {
+			cfg  config.ShardingConfig
+			want bool
+		}{
+			{cfg: config.ShardingConfig{}, want: true},
+			{cfg: config.ShardingConfig{NamespaceSelector: "shard=a"}, want: true},
+			{cfg: config.ShardingConfig{DatasetSelector: "shard=a"}, want: false},
+			{cfg: config.ShardingConfig{DatasetSelector: "shard=a", ScanOrphans: true}, want: true},
+		} {
+			shard, err := NewShard(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := shard.ScansOrphans(); got != tt.want {
+				t.Errorf("ScansOrphans() = %v for %+v, want %v", got, tt.cfg, tt.want)
+			}
+		}
+	})
+
+	t.Run("reconciler skips other shards", func(t *testing.T) {
+		shard, err := NewShard(config.ShardingConfig{NamespaceSelector: "shard=a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, bq := newFakeBigQuery(t)
+		faulty := NewFaultyBigQuery(bq)
+		r := NewBigQueryDatasetReconciler(c, s, faulty, WithShard(shard))
+
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "b1", Name: "ds"}}); err != nil {
+			t.Fatal(err)
+		}
+		var skipped naisv1.BigQueryDataset
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "b1", Name: "ds"}, &skipped); err != nil {
+			t.Fatal(err)
+		}
+		if len(skipped.Finalizers) > 0 || len(skipped.Status.Conditions) > 0 || faulty.Calls("Get", "") > 0 {
+			t.Errorf("expected dataset outside the shard to be left alone, got %+v", skipped)
+		}
+	})
+}
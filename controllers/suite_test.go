@@ -18,17 +18,16 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"net/http/httptest"
 	"os"
-	"sync"
 	"testing"
-	"time"
 
-	"cloud.google.com/go/bigquery"
+	"github.com/nais/bqrator/pkg/fakebigquery"
 	naisv1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
 	"github.com/nais/liberator/pkg/crd"
-	"google.golang.org/api/googleapi"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -47,9 +46,9 @@ var (
 	cfg       *rest.Config
 	k8sClient client.Client
 	testEnv   *envtest.Environment
-	bqMock    = &bqMocker{
-		state: map[string]*bigquery.DatasetMetadata{},
-	}
+	bqServer  *fakebigquery.Server
+	bqClient  BigQuery
+	bqFaults  *FaultyBigQuery
 )
 
 const (
@@ -94,9 +93,15 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
+	var stopBigQuery func()
+	bqServer, bqClient, stopBigQuery = startFakeBigQuery()
+	bqFaults = NewFaultyBigQuery(bqClient)
+
 	setupBigQueryDatasetController(ctx)
 	code := m.Run()
 
+	stopBigQuery()
+
 	if err := testEnv.Stop(); err != nil {
 		log.Println(err)
 	}
@@ -112,7 +117,7 @@ func setupBigQueryDatasetController(ctx context.Context) {
 		log.Fatal(err)
 	}
 
-	mgr := NewBigQueryDatasetReconciler(k8sManager.GetClient(), k8sManager.GetScheme(), bqMock)
+	mgr := NewBigQueryDatasetReconciler(k8sManager.GetClient(), k8sManager.GetScheme(), NewInstrumentedBigQuery(bqFaults))
 	if err := mgr.SetupWithManager(k8sManager); err != nil {
 		log.Fatal(err)
 	}
@@ -124,85 +129,23 @@ func setupBigQueryDatasetController(ctx context.Context) {
 	}()
 }
 
-type bqMocker struct {
-	mu          sync.Mutex
-	state       map[string]*bigquery.DatasetMetadata
-	updateCount int
-}
-
-func (b *bqMocker) Get(ctx context.Context, projectID, name string) (*bigquery.DatasetMetadata, error) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	fmt.Println("GET", projectID, name)
-	dm, ok := b.state[projectID+"_"+name]
-	if !ok {
-		return nil, fmt.Errorf("dataset not found")
-	}
-	return dm, nil
-}
-
-func (b *bqMocker) Create(ctx context.Context, projectID string, dataset *bigquery.DatasetMetadata) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	fmt.Println("CREATE", projectID, dataset.Name)
-	if _, ok := b.state[projectID+"_"+dataset.Name]; ok {
-		return &googleapi.Error{
-			Code:    409,
-			Message: dataset.Name + " already exists",
-		}
-	}
-	b.state[projectID+"_"+dataset.Name] = dataset
-	return nil
-}
+// startFakeBigQuery starts a fake BigQuery server, and returns it together
+// with a BigQuery implementation using real clients against it, and a function
+// stopping the server.
+func startFakeBigQuery() (*fakebigquery.Server, BigQuery, func()) {
+	server := fakebigquery.New()
+	srv := httptest.NewServer(server)
 
-func (b *bqMocker) Update(ctx context.Context, projectID, name string, dataset bigquery.DatasetMetadataToUpdate, etag string) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	fmt.Println("UPDATE", projectID, name)
-	b.updateCount++
-	dm, ok := b.state[projectID+"_"+name]
-	if !ok {
-		return fmt.Errorf("dataset not found")
+	pool := &ClientPool{
+		TokenSource:   oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		ClientOptions: []option.ClientOption{option.WithEndpoint(srv.URL)},
 	}
-	if dataset.Name != nil {
-		dm.Name = dataset.Name.(string)
-	}
-	if dataset.Access != nil {
-		dm.Access = dataset.Access
-	}
-	if dataset.Description != nil {
-		dm.Description = dataset.Description.(string)
-	}
-	if dataset.DefaultEncryptionConfig != nil {
-		dm.DefaultEncryptionConfig = dataset.DefaultEncryptionConfig
-	}
-	if dataset.DefaultTableExpiration != nil {
-		dm.DefaultTableExpiration = dataset.DefaultTableExpiration.(time.Duration)
-	}
-
-	return nil
+	return server, &BigQueryWrapper{Clients: pool}, srv.Close
 }
 
-func (b *bqMocker) GetUpdateCount() int {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	return b.updateCount
-}
-
-func (b *bqMocker) HasDataset(project, name string) bool {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	_, ok := b.state[project+"_"+name]
-	return ok
-}
-
-func (b *bqMocker) Delete(ctx context.Context, projectID, name string) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	fmt.Println("DELETE", projectID, name)
-	if _, ok := b.state[projectID+"_"+name]; !ok {
-		return fmt.Errorf("dataset not found")
-	}
-	delete(b.state, projectID+"_"+name)
-	return nil
+// newFakeBigQuery is startFakeBigQuery for a single test.
+func newFakeBigQuery(t *testing.T) (*fakebigquery.Server, BigQuery) {
+	server, bq, stop := startFakeBigQuery()
+	t.Cleanup(stop)
+	return server, bq
 }
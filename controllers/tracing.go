@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"context"
+
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses the global tracer provider, which is a no-op unless tracing is
+// set up in main.
+var tracer = otel.Tracer("github.com/nais/bqrator/controllers")
+
+// startSpan starts a span for an operation on dataset, with the dataset and
+// the team owning it as attributes.
+func startSpan(ctx context.Context, name string, dataset google_nais_io_v1.BigQueryDataset) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("bqrator.dataset.name", dataset.Name),
+		attribute.String("bqrator.dataset.namespace", dataset.Namespace),
+		attribute.String("bqrator.team", dataset.Namespace),
+		attribute.String("bqrator.bigquery.dataset", dataset.Spec.Name),
+	))
+}
+
+// endSpan ends span, recording err if it isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -20,9 +20,12 @@ import (
 	"context"
 	"flag"
 	"os"
+	"time"
 
 	"github.com/nais/bqrator/controllers"
+	"github.com/nais/bqrator/pkg/config"
 	"github.com/nais/bqrator/pkg/metrics"
+	"github.com/nais/bqrator/pkg/tracing"
 	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -37,10 +40,13 @@ import (
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
-	"cloud.google.com/go/bigquery"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
+// defaultLeaderElectionID is the leader election ID of an instance of bqrator
+// responsible for the whole cluster.
+const defaultLeaderElectionID = "73585216.nais.io"
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -58,48 +64,203 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionID string
+	var leaderElectionNamespace string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+	var gracefulShutdownTimeout time.Duration
 	var probeAddr string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0.0.0.0:8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", "0.0.0.0:8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.Parse()
+	flag.StringVar(&leaderElectionID, "leader-election-id", defaultLeaderElectionID,
+		"Name of the lease used for leader election. Instances sharding a cluster must use distinct IDs.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"Namespace of the lease used for leader election. Defaults to the namespace bqrator runs in.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"How long replicas that aren't leading wait before trying to take over a lease that hasn't been renewed.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"How long the leader keeps trying to renew the lease before giving up leadership.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"How long replicas wait between attempts to acquire or renew the lease.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"How long in-flight reconciles and BigQuery changes get to finish on shutdown, before the lease is released.")
 
 	ctrl.SetLogger(zap.New(zap.JSONEncoder()))
 
+	cfg := config.Default()
+	if err := cfg.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		setupLog.Error(err, "invalid configuration")
+		os.Exit(1)
+	}
+
+	shard, err := controllers.NewShard(cfg.Sharding)
+	if err != nil {
+		setupLog.Error(err, "invalid sharding configuration")
+		os.Exit(1)
+	}
+	if cfg.Sharding.Enabled() && enableLeaderElection && leaderElectionID == defaultLeaderElectionID {
+		setupLog.Error(nil, "sharding requires a --leader-election-id distinct to the shard, "+
+			"as instances with the same ID only run one at a time")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "73585216.nais.io",
+		Cache:                   controllers.ProjectMapCacheOptions(shard.CacheOptions(), cfg.Project),
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
+		// Release the lease on shutdown, once in-flight reconciles have
+		// finished, so that the next leader takes over without waiting for the
+		// lease to expire.
+		LeaderElectionReleaseOnCancel: true,
+		GracefulShutdownTimeout:       &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	bqClient, err := bigquery.NewClient(context.Background(), "")
+	// Datasets in namespaces outside the shard are cached, but belong to
+	// another instance.
+	shardReader := shard.Reader(mgr.GetClient())
+	runtimemetrics.Registry.MustRegister(&metrics.DatasetCollector{Reader: shardReader})
+	if err := mgr.AddMetricsServerExtraHandler("/datasets", &controllers.InventoryHandler{Reader: shardReader}); err != nil {
+		setupLog.Error(err, "unable to serve dataset inventory")
+		os.Exit(1)
+	}
+
+	pool, err := controllers.NewClientPool(context.Background(), cfg.ClientIdleTimeout.Duration)
 	if err != nil {
-		setupLog.Error(err, "unable to create bigquery client")
+		setupLog.Error(err, "unable to create bigquery client pool")
+		os.Exit(1)
+	}
+	pool.Email = cfg.OwnerEmail
+	if err := mgr.Add(pool); err != nil {
+		setupLog.Error(err, "unable to add bigquery client pool to manager")
 		os.Exit(1)
 	}
 
-	bqMgr := controllers.NewBigQueryDatasetReconciler(mgr.GetClient(), mgr.GetScheme(), &controllers.BigQueryWrapper{Client: bqClient})
+	resolver := controllers.NewProjectResolver(mgr.GetClient(), cfg.Project)
+
+	wrapper := &controllers.BigQueryWrapper{Clients: pool}
+	var identity controllers.Identifier = pool
+	if cfg.Impersonation.Annotation != "" {
+		factory := &controllers.ImpersonatingClientFactory{
+			Reader:     mgr.GetClient(),
+			Annotation: cfg.Impersonation.Annotation,
+			Clients:    pool,
+		}
+		if cfg.Impersonation.Fallback {
+			factory.Fallback = pool
+		}
+		wrapper.Clients = factory
+		identity = factory
+	}
+
+	// Changes in BigQuery that have started when the manager shuts down get to
+	// finish, so that the next leader doesn't find them half applied.
+	var bq controllers.BigQuery = controllers.NewGracefulBigQuery(wrapper, gracefulShutdownTimeout)
+	if cfg.RateLimit.BigQueryQPS > 0 {
+		bq = controllers.NewRateLimitedBigQuery(bq, cfg.RateLimit.BigQueryQPS, cfg.RateLimit.BigQueryBurst)
+	}
+	opts := []controllers.Option{
+		controllers.WithConfig(cfg),
+		controllers.WithProjectResolver(resolver),
+		controllers.WithShard(shard),
+		controllers.WithIdentity(identity),
+	}
+	if cfg.AuditFile != "" {
+		fileSink, err := controllers.NewFileAuditSink(cfg.AuditFile)
+		if err != nil {
+			setupLog.Error(err, "unable to set up audit file")
+			os.Exit(1)
+		}
+		defer fileSink.Close()
+		opts = append(opts, controllers.WithAuditSink(controllers.AuditSinks{
+			&controllers.LogAuditSink{Log: ctrl.Log.WithName("audit")},
+			fileSink,
+		}))
+	}
+
+	// Instrument the calls that reach BigQuery, including any time spent rate
+	// limited. Changes skipped in dry-run mode are counted by
+	// bqrator_bigquery_dry_run_calls_count instead.
+	bq = controllers.NewInstrumentedBigQuery(bq)
+
+	if cfg.DryRun {
+		setupLog.Info("running in dry-run mode, no changes will be made in BigQuery")
+		dryRunBQ := controllers.NewDryRunBigQuery(bq)
+		bq = dryRunBQ
+		opts = append(opts, controllers.WithDryRun(dryRunBQ))
+	}
+
+	bqMgr := controllers.NewBigQueryDatasetReconciler(mgr.GetClient(), mgr.GetScheme(), bq, opts...)
 	if err = bqMgr.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BigQueryDataset")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	if cfg.OrphanScanInterval.Duration > 0 && !shard.ScansOrphans() {
+		setupLog.Info("orphan scan is left to the shard with --shard-scan-orphans")
+	} else if cfg.OrphanScanInterval.Duration > 0 {
+		// The scan must see every BigQueryDataset in the shard's namespaces, also
+		// those left out of the cache by the dataset selector, or datasets of
+		// other instances would be reported as orphans.
+		scanner := controllers.NewOrphanScanner(shard.Reader(mgr.GetAPIReader()), bq, resolver, cfg.OrphanScanInterval.Duration)
+		if err := mgr.Add(scanner); err != nil {
+			setupLog.Error(err, "unable to add orphan scanner to manager")
+			os.Exit(1)
+		}
+		if err := mgr.AddMetricsServerExtraHandler("/orphans", scanner); err != nil {
+			setupLog.Error(err, "unable to serve orphan report")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	// The readiness check lists datasets in the operator's own project, unless
+	// another project is configured.
+	readinessProject := cfg.Readiness.Project
+	if readinessProject == "" {
+		readinessProject = pool.ProjectID
+	}
+	if readinessProject == "" {
+		setupLog.Error(nil, "readiness.project must be set, as the project of the credentials is unknown")
+		os.Exit(1)
+	}
+	readiness := controllers.NewReadinessChecker(func(ctx context.Context) error {
+		return pool.Ping(ctx, readinessProject)
+	}, cfg.Readiness.Interval.Duration, cfg.Readiness.Timeout.Duration)
+	if err := mgr.Add(readiness); err != nil {
+		setupLog.Error(err, "unable to add readiness checker to manager")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", readiness.Checker); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
@@ -0,0 +1,383 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the BigQueryDataset controller.
+type Config struct {
+	// OwnerEmail is given OWNER access to every dataset, so that bqrator can
+	// keep managing it.
+	OwnerEmail string `json:"ownerEmail"`
+	// AllowedLocations restricts where datasets can be created. All locations
+	// are allowed if empty.
+	AllowedLocations []string `json:"allowedLocations"`
+	// ResyncInterval is how often datasets are compared with BigQuery even if
+	// their spec hasn't changed. Zero disables periodic resync.
+	ResyncInterval          metav1.Duration     `json:"resyncInterval"`
+	MaxConcurrentReconciles int                 `json:"maxConcurrentReconciles"`
+	DryRun                  bool                `json:"dryRun"`
+	Project                 ProjectConfig       `json:"project"`
+	Impersonation           ImpersonationConfig `json:"impersonation"`
+	ClientIdleTimeout       metav1.Duration     `json:"clientIdleTimeout"`
+	RateLimit               RateLimitConfig     `json:"rateLimit"`
+	Tracing                 TracingConfig       `json:"tracing"`
+	// AuditFile is a file audit records of access changes are appended to, in
+	// addition to the audit log. Nothing is written to file if empty.
+	AuditFile string          `json:"auditFile"`
+	Readiness ReadinessConfig `json:"readiness"`
+	// OrphanScanInterval is how often datasets labelled with a team are
+	// checked for a BigQueryDataset managing them. Zero disables the scan.
+	OrphanScanInterval metav1.Duration `json:"orphanScanInterval"`
+	Sharding           ShardingConfig  `json:"sharding"`
+}
+
+// ProjectConfig configures how the GCP project of a dataset is resolved.
+type ProjectConfig struct {
+	LabelKeys      []string `json:"labelKeys"`
+	AnnotationKeys []string `json:"annotationKeys"`
+	// MapConfigMap is a ConfigMap, given as <namespace>/<name>, mapping
+	// namespaces to GCP projects. It is cached and read on every lookup, so
+	// changes apply from the next reconcile of a dataset.
+	MapConfigMap string `json:"mapConfigMap"`
+	// SpecProjectNamespaces are the namespaces where spec.project is used, or
+	// "*" for all namespaces.
+	SpecProjectNamespaces []string `json:"specProjectNamespaces"`
+}
+
+// ImpersonationConfig configures impersonation of per-namespace Google
+// service accounts.
+type ImpersonationConfig struct {
+	Annotation string `json:"annotation"`
+	Fallback   bool   `json:"fallback"`
+}
+
+// RateLimitConfig configures how fast datasets are requeued, and how fast
+// BigQuery is called.
+type RateLimitConfig struct {
+	// RequeueBaseDelay and RequeueMaxDelay bound the per-dataset exponential
+	// backoff after failed reconciles.
+	RequeueBaseDelay metav1.Duration `json:"requeueBaseDelay"`
+	RequeueMaxDelay  metav1.Duration `json:"requeueMaxDelay"`
+	// RequeueQPS and RequeueBurst limit requeues across all datasets.
+	RequeueQPS   float64 `json:"requeueQPS"`
+	RequeueBurst int     `json:"requeueBurst"`
+	// BigQueryQPS and BigQueryBurst limit calls to the BigQuery API. Calls are
+	// not limited if BigQueryQPS is zero.
+	BigQueryQPS   float64 `json:"bigQueryQPS"`
+	BigQueryBurst int     `json:"bigQueryBurst"`
+}
+
+// TracingConfig configures export of traces with OTLP over gRPC. Tracing is
+// disabled if Endpoint is empty. The standard OTEL_EXPORTER_OTLP_* environment
+// variables can be used for further configuration of the exporter.
+type TracingConfig struct {
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+	// SampleRatio is the fraction of reconciles that are traced.
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+// ReadinessConfig configures the connectivity check behind the readiness
+// probe.
+type ReadinessConfig struct {
+	// Project is listed to check access to BigQuery. If empty, the project of
+	// the application default credentials is listed.
+	Project  string          `json:"project"`
+	Interval metav1.Duration `json:"interval"`
+	Timeout  metav1.Duration `json:"timeout"`
+}
+
+// ShardingConfig restricts the BigQueryDatasets an instance of bqrator is
+// responsible for, so that several instances can share a cluster. Everything
+// is included if all fields are empty.
+type ShardingConfig struct {
+	// Namespaces are the only namespaces watched.
+	Namespaces []string `json:"namespaces"`
+	// NamespaceSelector is a label selector for the namespaces whose
+	// BigQueryDatasets are reconciled.
+	NamespaceSelector string `json:"namespaceSelector"`
+	// DatasetSelector is a label selector for the BigQueryDatasets reconciled.
+	DatasetSelector string `json:"datasetSelector"`
+	// ScanOrphans makes this instance scan for orphans when BigQueryDatasets
+	// are sharded by DatasetSelector. Shards selecting datasets share their
+	// namespaces, and so their orphans, so only one of them should scan.
+	ScanOrphans bool `json:"scanOrphans"`
+}
+
+// Enabled reports whether any restriction is configured.
+func (c ShardingConfig) Enabled() bool {
+	return len(c.Namespaces) > 0 || c.NamespaceSelector != "" || c.DatasetSelector != ""
+}
+
+// Default returns the default configuration. OwnerEmail defaults to the
+// SA_ACCOUNT_EMAIL environment variable.
+func Default() Config {
+	return Config{
+		OwnerEmail:              os.Getenv("SA_ACCOUNT_EMAIL"),
+		MaxConcurrentReconciles: 1,
+		Project: ProjectConfig{
+			LabelKeys:      []string{"google-cloud-project"},
+			AnnotationKeys: []string{"cnrm.cloud.google.com/project-id"},
+		},
+		ClientIdleTimeout: metav1.Duration{Duration: 30 * time.Minute},
+		RateLimit: RateLimitConfig{
+			RequeueBaseDelay: metav1.Duration{Duration: 5 * time.Millisecond},
+			RequeueMaxDelay:  metav1.Duration{Duration: 1000 * time.Second},
+			RequeueQPS:       10,
+			RequeueBurst:     100,
+			BigQueryQPS:      10,
+			BigQueryBurst:    20,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Readiness: ReadinessConfig{
+			Interval: metav1.Duration{Duration: time.Minute},
+			Timeout:  metav1.Duration{Duration: 10 * time.Second},
+		},
+	}
+}
+
+// Parse parses args into c. Values are taken from, in increasing order of
+// precedence, the current values of c, the file given by the --config flag,
+// and the remaining flags. Flags not belonging to the config must be defined
+// on fs before calling Parse.
+func (c *Config) Parse(fs *flag.FlagSet, args []string) error {
+	var path string
+	fs.StringVar(&path, "config", "", "Path to a YAML configuration file. Flags take precedence over the file.")
+	c.bindFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return err
+		}
+
+		// Parse again so that flags override the values from the file
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+	}
+
+	return c.Validate()
+}
+
+// Load returns the default configuration, overridden by the file at path.
+func Load(path string) (Config, error) {
+	c := Default()
+	if err := c.readFile(path); err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.OwnerEmail, "owner-email", c.OwnerEmail,
+		"Email of the service account given OWNER access to every dataset.")
+	fs.Var(&stringList{&c.AllowedLocations}, "allowed-locations",
+		"Comma separated locations datasets can be created in. All locations are allowed if empty.")
+	fs.Var(&duration{&c.ResyncInterval}, "resync-interval",
+		"How often datasets are compared with BigQuery even if their spec is unchanged. Zero disables periodic resync.")
+	fs.IntVar(&c.MaxConcurrentReconciles, "max-concurrent-reconciles", c.MaxConcurrentReconciles,
+		"Maximum number of BigQueryDatasets reconciled concurrently.")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun,
+		"Only read from BigQuery, and log and record intended changes instead of applying them.")
+	fs.Var(&stringList{&c.Project.LabelKeys}, "project-label-keys",
+		"Comma separated namespace labels to read the GCP project from, in order of precedence.")
+	fs.Var(&stringList{&c.Project.AnnotationKeys}, "project-annotation-keys",
+		"Comma separated namespace annotations to read the GCP project from, used if none of the labels are set.")
+	fs.StringVar(&c.Project.MapConfigMap, "project-map-configmap", c.Project.MapConfigMap,
+		"A ConfigMap, given as <namespace>/<name>, mapping namespaces to GCP projects. Takes precedence over namespace labels and annotations.")
+	fs.Var(&stringList{&c.Project.SpecProjectNamespaces}, "spec-project-namespaces",
+		"Comma separated namespaces where spec.project is used as the GCP project, or '*' for all namespaces.")
+	fs.StringVar(&c.Impersonation.Annotation, "impersonate-annotation", c.Impersonation.Annotation,
+		"Namespace annotation holding a Google service account to impersonate for BigQuery calls. Impersonation is disabled if empty.")
+	fs.BoolVar(&c.Impersonation.Fallback, "impersonate-fallback", c.Impersonation.Fallback,
+		"Use the operator's own credentials for namespaces without the impersonation annotation, instead of failing.")
+	fs.Var(&duration{&c.ClientIdleTimeout}, "bigquery-client-idle-timeout",
+		"How long a BigQuery client for a project is kept after its last use.")
+	fs.Var(&duration{&c.RateLimit.RequeueBaseDelay}, "requeue-base-delay",
+		"Initial delay before a failed dataset is reconciled again. The delay doubles on each failure.")
+	fs.Var(&duration{&c.RateLimit.RequeueMaxDelay}, "requeue-max-delay",
+		"Maximum delay before a failed dataset is reconciled again.")
+	fs.Float64Var(&c.RateLimit.RequeueQPS, "requeue-qps", c.RateLimit.RequeueQPS,
+		"Maximum rate of requeues per second across all datasets.")
+	fs.IntVar(&c.RateLimit.RequeueBurst, "requeue-burst", c.RateLimit.RequeueBurst,
+		"Maximum burst of requeues across all datasets.")
+	fs.Float64Var(&c.RateLimit.BigQueryQPS, "bigquery-qps", c.RateLimit.BigQueryQPS,
+		"Maximum rate of BigQuery API calls per second. Zero disables the limit.")
+	fs.IntVar(&c.RateLimit.BigQueryBurst, "bigquery-burst", c.RateLimit.BigQueryBurst,
+		"Maximum burst of BigQuery API calls.")
+	fs.StringVar(&c.Tracing.Endpoint, "otlp-endpoint", c.Tracing.Endpoint,
+		"OTLP gRPC endpoint, as host:port, to export traces to. Tracing is disabled if empty.")
+	fs.BoolVar(&c.Tracing.Insecure, "otlp-insecure", c.Tracing.Insecure,
+		"Export traces without TLS, e.g. to a local collector.")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio,
+		"Fraction of reconciles that are traced, between 0 and 1.")
+	fs.StringVar(&c.AuditFile, "audit-file", c.AuditFile,
+		"File to append audit records of access changes to, as JSON lines, in addition to the audit log.")
+	fs.StringVar(&c.Readiness.Project, "readiness-project", c.Readiness.Project,
+		"GCP project whose datasets are listed to check BigQuery access for the readiness probe. The project of the application default credentials is used if empty.")
+	fs.Var(&duration{&c.Readiness.Interval}, "readiness-interval",
+		"How often BigQuery connectivity is checked for the readiness probe.")
+	fs.Var(&duration{&c.Readiness.Timeout}, "readiness-timeout",
+		"Timeout of each BigQuery connectivity check.")
+	fs.Var(&duration{&c.OrphanScanInterval}, "orphan-scan-interval",
+		"How often datasets labelled with a team are checked for a BigQueryDataset managing them. Orphans are reported at /orphans on the metrics server. Zero disables the scan.")
+	fs.Var(&stringList{&c.Sharding.Namespaces}, "watch-namespaces",
+		"Comma separated namespaces to watch. All namespaces are watched if empty.")
+	fs.StringVar(&c.Sharding.NamespaceSelector, "namespace-selector", c.Sharding.NamespaceSelector,
+		"Label selector for the namespaces whose BigQueryDatasets are reconciled, e.g. 'bqrator-shard=a'.")
+	fs.StringVar(&c.Sharding.DatasetSelector, "dataset-selector", c.Sharding.DatasetSelector,
+		"Label selector for the BigQueryDatasets reconciled.")
+	fs.BoolVar(&c.Sharding.ScanOrphans, "shard-scan-orphans", c.Sharding.ScanOrphans,
+		"Scan for orphans in this instance although --dataset-selector is set. Set it on only one of the shards selecting datasets.")
+}
+
+// Validate returns an error describing every invalid value in c.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.OwnerEmail != "" && !strings.Contains(c.OwnerEmail, "@") {
+		errs = append(errs, fmt.Errorf("ownerEmail %q is not an email address", c.OwnerEmail))
+	}
+	if c.ResyncInterval.Duration < 0 {
+		errs = append(errs, errors.New("resyncInterval can't be negative"))
+	}
+	if c.MaxConcurrentReconciles < 1 {
+		errs = append(errs, errors.New("maxConcurrentReconciles must be at least 1"))
+	}
+	if len(c.Project.LabelKeys) == 0 && len(c.Project.AnnotationKeys) == 0 {
+		errs = append(errs, errors.New("project.labelKeys and project.annotationKeys can't both be empty"))
+	}
+	if c.Project.MapConfigMap != "" {
+		if namespace, name, ok := strings.Cut(c.Project.MapConfigMap, "/"); !ok || namespace == "" || name == "" {
+			errs = append(errs, fmt.Errorf("project.mapConfigMap must be given as <namespace>/<name>, got %q", c.Project.MapConfigMap))
+		}
+	}
+	if c.Impersonation.Fallback && c.Impersonation.Annotation == "" {
+		errs = append(errs, errors.New("impersonation.fallback requires impersonation.annotation"))
+	}
+	if c.ClientIdleTimeout.Duration < 0 {
+		errs = append(errs, errors.New("clientIdleTimeout can't be negative"))
+	}
+	errs = append(errs, c.RateLimit.validate())
+	if c.Readiness.Interval.Duration <= 0 {
+		errs = append(errs, errors.New("readiness.interval must be positive"))
+	}
+	if c.Readiness.Timeout.Duration <= 0 {
+		errs = append(errs, errors.New("readiness.timeout must be positive"))
+	}
+	if c.OrphanScanInterval.Duration < 0 {
+		errs = append(errs, errors.New("orphanScanInterval can't be negative"))
+	}
+	if _, err := labels.Parse(c.Sharding.NamespaceSelector); err != nil {
+		errs = append(errs, fmt.Errorf("sharding.namespaceSelector: %w", err))
+	}
+	if _, err := labels.Parse(c.Sharding.DatasetSelector); err != nil {
+		errs = append(errs, fmt.Errorf("sharding.datasetSelector: %w", err))
+	}
+	if c.Sharding.ScanOrphans && c.Sharding.DatasetSelector == "" {
+		errs = append(errs, errors.New("sharding.scanOrphans requires sharding.datasetSelector"))
+	}
+	if c.Tracing.Endpoint != "" {
+		// The chart opens egress to the host and port of the endpoint.
+		if _, _, err := net.SplitHostPort(c.Tracing.Endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("tracing.endpoint must be given as host:port: %w", err))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+	return errors.Join(errs...)
+}
+
+// stringList is a flag.Value for comma separated lists.
+type stringList struct {
+	values *[]string
+}
+
+func (s *stringList) String() string {
+	if s.values == nil {
+		return ""
+	}
+	return strings.Join(*s.values, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s.values = nil
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*s.values = append(*s.values, item)
+		}
+	}
+	return nil
+}
+
+// duration is a flag.Value for metav1.Duration.
+type duration struct {
+	value *metav1.Duration
+}
+
+func (d *duration) String() string {
+	if d.value == nil {
+		return ""
+	}
+	return d.value.Duration.String()
+}
+
+func (d *duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.value.Duration = parsed
+	return nil
+}
+
+func (c *RateLimitConfig) validate() error {
+	var errs []error
+	if c.RequeueBaseDelay.Duration <= 0 {
+		errs = append(errs, errors.New("rateLimit.requeueBaseDelay must be positive"))
+	}
+	if c.RequeueMaxDelay.Duration < c.RequeueBaseDelay.Duration {
+		errs = append(errs, errors.New("rateLimit.requeueMaxDelay can't be less than rateLimit.requeueBaseDelay"))
+	}
+	if c.RequeueQPS <= 0 {
+		errs = append(errs, errors.New("rateLimit.requeueQPS must be positive"))
+	}
+	if c.RequeueBurst < 1 {
+		errs = append(errs, errors.New("rateLimit.requeueBurst must be at least 1"))
+	}
+	if c.BigQueryQPS < 0 {
+		errs = append(errs, errors.New("rateLimit.bigQueryQPS can't be negative"))
+	}
+	if c.BigQueryQPS > 0 && c.BigQueryBurst < 1 {
+		errs = append(errs, errors.New("rateLimit.bigQueryBurst must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
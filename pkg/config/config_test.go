@@ -0,0 +1,152 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+ownerEmail: file@example.com
+allowedLocations: [europe-north1]
+resyncInterval: 1h
+maxConcurrentReconciles: 4
+project:
+  labelKeys: [team-project]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	err = cfg.Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"--config", path,
+		"--max-concurrent-reconciles", "8",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if cfg.OwnerEmail != "file@example.com" {
+		t.Errorf("OwnerEmail = %q, want value from file", cfg.OwnerEmail)
+	}
+	if !slices.Equal(cfg.AllowedLocations, []string{"europe-north1"}) {
+		t.Errorf("AllowedLocations = %v, want value from file", cfg.AllowedLocations)
+	}
+	if cfg.ResyncInterval.Duration != time.Hour {
+		t.Errorf("ResyncInterval = %v, want value from file", cfg.ResyncInterval.Duration)
+	}
+	if cfg.MaxConcurrentReconciles != 8 {
+		t.Errorf("MaxConcurrentReconciles = %d, want flag to take precedence over file", cfg.MaxConcurrentReconciles)
+	}
+	if !slices.Equal(cfg.Project.LabelKeys, []string{"team-project"}) {
+		t.Errorf("Project.LabelKeys = %v, want value from file", cfg.Project.LabelKeys)
+	}
+	if !slices.Equal(cfg.Project.AnnotationKeys, []string{"cnrm.cloud.google.com/project-id"}) {
+		t.Errorf("Project.AnnotationKeys = %v, want default", cfg.Project.AnnotationKeys)
+	}
+	if cfg.ClientIdleTimeout.Duration != 30*time.Minute {
+		t.Errorf("ClientIdleTimeout = %v, want default", cfg.ClientIdleTimeout.Duration)
+	}
+}
+
+func TestParseUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ownerMail: typo@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	if err := cfg.Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", path}); err == nil {
+		t.Error("Parse() succeeded with an unknown field in the config file")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+project:
+  mapConfigMap: bqrator/projects
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Project.MapConfigMap != "bqrator/projects" {
+		t.Errorf("Project.MapConfigMap = %q, want value from file", cfg.Project.MapConfigMap)
+	}
+	if !slices.Equal(cfg.Project.LabelKeys, []string{"google-cloud-project"}) {
+		t.Errorf("Project.LabelKeys = %v, want default", cfg.Project.LabelKeys)
+	}
+
+	if err := os.WriteFile(path, []byte("project:\n  mapConfigMap: projects\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() succeeded with an invalid config file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "default", modify: func(*Config) {}},
+		{name: "owner not an email", modify: func(c *Config) { c.OwnerEmail = "bqrator" }, wantErr: true},
+		{name: "negative resync", modify: func(c *Config) { c.ResyncInterval.Duration = -time.Second }, wantErr: true},
+		{name: "no concurrency", modify: func(c *Config) { c.MaxConcurrentReconciles = 0 }, wantErr: true},
+		{name: "no project keys", modify: func(c *Config) {
+			c.Project.LabelKeys = nil
+			c.Project.AnnotationKeys = nil
+		}, wantErr: true},
+		{name: "configmap without namespace", modify: func(c *Config) { c.Project.MapConfigMap = "projects" }, wantErr: true},
+		{name: "configmap", modify: func(c *Config) { c.Project.MapConfigMap = "bqrator/projects" }},
+		{name: "fallback without annotation", modify: func(c *Config) { c.Impersonation.Fallback = true }, wantErr: true},
+		{name: "max delay below base delay", modify: func(c *Config) { c.RateLimit.RequeueMaxDelay.Duration = time.Millisecond }, wantErr: true},
+		{name: "no requeue burst", modify: func(c *Config) { c.RateLimit.RequeueBurst = 0 }, wantErr: true},
+		{name: "unlimited bigquery", modify: func(c *Config) {
+			c.RateLimit.BigQueryQPS = 0
+			c.RateLimit.BigQueryBurst = 0
+		}},
+		{name: "tracing endpoint", modify: func(c *Config) { c.Tracing.Endpoint = "otel-collector.monitoring:4317" }},
+		{name: "tracing endpoint without port", modify: func(c *Config) { c.Tracing.Endpoint = "otel-collector.monitoring" }, wantErr: true},
+		{name: "sample ratio above 1", modify: func(c *Config) { c.Tracing.SampleRatio = 2 }, wantErr: true},
+		{name: "no bigquery burst", modify: func(c *Config) { c.RateLimit.BigQueryBurst = 0 }, wantErr: true},
+		{name: "sharding", modify: func(c *Config) {
+			c.Sharding.Namespaces = []string{"a", "b"}
+			c.Sharding.NamespaceSelector = "shard in (a, b)"
+			c.Sharding.DatasetSelector = "!legacy"
+		}},
+		{name: "invalid namespace selector", modify: func(c *Config) { c.Sharding.NamespaceSelector = "shard in a" }, wantErr: true},
+		{name: "orphan scanning shard", modify: func(c *Config) {
+			c.Sharding.DatasetSelector = "shard=a"
+			c.Sharding.ScanOrphans = true
+		}},
+		{name: "orphan scanning without dataset selector", modify: func(c *Config) { c.Sharding.ScanOrphans = true }, wantErr: true},
+		{name: "invalid dataset selector", modify: func(c *Config) { c.Sharding.DatasetSelector = "=a" }, wantErr: true},
+		{name: "negative orphan scan", modify: func(c *Config) { c.OrphanScanInterval.Duration = -time.Hour }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.OwnerEmail = "bqrator@example.com"
+			tt.modify(&cfg)
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,532 @@
+// Package fakebigquery is an in-process fake of the BigQuery datasets REST API,
+// for testing code using a real bigquery.Client without access to GCP.
+//
+// It supports getting, listing, inserting, patching and deleting datasets,
+// including ETag preconditions on patch and validation of access entries, and
+// can be told to fail requests with given status codes.
+package fakebigquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bqv2 "google.golang.org/api/bigquery/v2"
+)
+
+// Fault makes matching requests fail with Code. Empty fields match any request.
+type Fault struct {
+	// Method is the HTTP method of the request, such as http.MethodPatch.
+	Method    string
+	ProjectID string
+	DatasetID string
+
+	Code    int
+	Message string
+	// Times is the number of requests to fail. Zero fails every matching
+	// request until ClearFaults is called.
+	Times int
+}
+
+// Server is an http.Handler serving the BigQuery datasets API. Point a client
+// at it with option.WithEndpoint and the URL of an httptest.Server.
+type Server struct {
+	mu       sync.Mutex
+	datasets map[datasetKey]*bqv2.Dataset
+	faults   []*Fault
+	requests map[string]int
+	etagSeq  int
+	mux      *http.ServeMux
+}
+
+type datasetKey struct {
+	projectID string
+	datasetID string
+}
+
+var _ http.Handler = &Server{}
+
+func New() *Server {
+	s := &Server{
+		datasets: map[datasetKey]*bqv2.Dataset{},
+		requests: map[string]int{},
+		mux:      http.NewServeMux(),
+	}
+
+	// Clients use the /bigquery/v2 prefix unless the endpoint is overridden
+	// without it
+	for _, prefix := range []string{"", "/bigquery/v2"} {
+		s.mux.HandleFunc("GET "+prefix+"/projects/{project}/datasets", s.list)
+		s.mux.HandleFunc("POST "+prefix+"/projects/{project}/datasets", s.insert)
+		s.mux.HandleFunc("GET "+prefix+"/projects/{project}/datasets/{dataset}", s.get)
+		s.mux.HandleFunc("PATCH "+prefix+"/projects/{project}/datasets/{dataset}", s.patch)
+		s.mux.HandleFunc("DELETE "+prefix+"/projects/{project}/datasets/{dataset}", s.delete)
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.Method]++
+	fault := s.fault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		message := fault.Message
+		if message == "" {
+			message = http.StatusText(fault.Code)
+		}
+		writeError(w, fault.Code, message)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// InjectFault makes matching requests fail until the fault has been used
+// Times times.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the number of requests received with the HTTP method,
+// including failed requests.
+func (s *Server) Requests(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// HasDataset reports whether the dataset exists.
+func (s *Server) HasDataset(projectID, datasetID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.datasets[datasetKey{projectID, datasetID}]
+	return ok
+}
+
+// Dataset returns a copy of the dataset, as it would be returned by the API.
+func (s *Server) Dataset(projectID, datasetID string) (*bqv2.Dataset, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, ok := s.datasets[datasetKey{projectID, datasetID}]
+	if !ok {
+		return nil, false
+	}
+	return clone(ds), true
+}
+
+// Modify changes the dataset outside of the API, as if someone else changed
+// it, and gives it a new ETag. It returns false if the dataset doesn't exist.
+func (s *Server) Modify(projectID, datasetID string, modify func(*bqv2.Dataset)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, ok := s.datasets[datasetKey{projectID, datasetID}]
+	if !ok {
+		return false
+	}
+	modify(ds)
+	s.touch(ds)
+	return true
+}
+
+// fault returns the first injected fault matching r, if any, and uses it up.
+func (s *Server) fault(r *http.Request) *Fault {
+	projectID, datasetID := pathIDs(r.URL.Path)
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) ||
+			(f.ProjectID != "" && f.ProjectID != projectID) ||
+			(f.DatasetID != "" && f.DatasetID != datasetID) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// pathIDs returns the project and dataset IDs in a request path, since path
+// values aren't available before routing.
+func pathIDs(path string) (string, string) {
+	_, rest, ok := strings.Cut(path, "/projects/")
+	if !ok {
+		return "", ""
+	}
+	projectID, rest, _ := strings.Cut(rest, "/")
+	_, datasetID, _ := strings.Cut(rest, "datasets/")
+	datasetID, _, _ = strings.Cut(datasetID, "/")
+	return projectID, datasetID
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds, ok := s.datasets[keyOf(r)]
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, ds)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projectID := r.PathValue("project")
+	filter, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var ids []string
+	for key, ds := range s.datasets {
+		if key.projectID == projectID && filter.matches(ds) {
+			ids = append(ids, key.datasetID)
+		}
+	}
+	slices.Sort(ids)
+
+	start := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > len(ids) {
+			writeError(w, http.StatusBadRequest, "Invalid page token")
+			return
+		}
+	}
+	end := len(ids)
+	if max, err := strconv.Atoi(r.URL.Query().Get("maxResults")); err == nil && max > 0 && start+max < end {
+		end = start + max
+	}
+
+	list := &bqv2.DatasetList{Kind: "bigquery#datasetList"}
+	for _, id := range ids[start:end] {
+		ds := s.datasets[datasetKey{projectID, id}]
+		list.Datasets = append(list.Datasets, &bqv2.DatasetListDatasets{
+			DatasetReference: ds.DatasetReference,
+			FriendlyName:     ds.FriendlyName,
+			Id:               ds.Id,
+			Kind:             "bigquery#dataset",
+			Labels:           ds.Labels,
+			Location:         ds.Location,
+		})
+	}
+	if end < len(ids) {
+		list.NextPageToken = strconv.Itoa(end)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) insert(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project")
+
+	ds := &bqv2.Dataset{}
+	if err := json.NewDecoder(r.Body).Decode(ds); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
+		return
+	}
+	if ds.DatasetReference == nil || ds.DatasetReference.DatasetId == "" {
+		writeError(w, http.StatusBadRequest, "Required parameter is missing: datasetReference.datasetId")
+		return
+	}
+	if ds.DatasetReference.ProjectId == "" {
+		ds.DatasetReference.ProjectId = projectID
+	}
+	if ds.DatasetReference.ProjectId != projectID {
+		writeError(w, http.StatusBadRequest, "Dataset project doesn't match the project in the request path")
+		return
+	}
+	if err := validateAccess(ds.Access); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := datasetKey{projectID, ds.DatasetReference.DatasetId}
+	if _, ok := s.datasets[key]; ok {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Already Exists: Dataset %s:%s", key.projectID, key.datasetID))
+		return
+	}
+
+	ds.Kind = "bigquery#dataset"
+	ds.Id = key.projectID + ":" + key.datasetID
+	if ds.Location == "" {
+		ds.Location = "US"
+	}
+	ds.CreationTime = time.Now().UnixMilli()
+	s.touch(ds)
+	s.datasets[key] = ds
+	writeJSON(w, http.StatusOK, ds)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds, ok := s.datasets[keyOf(r)]
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+	if etag := r.Header.Get("If-Match"); etag != "" && etag != ds.Etag {
+		writeError(w, http.StatusPreconditionFailed, "Precondition check failed.")
+		return
+	}
+
+	updated := clone(ds)
+	if err := applyPatch(updated, fields); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateAccess(updated.Access); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.touch(updated)
+	s.datasets[keyOf(r)] = updated
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.datasets[keyOf(r)]; !ok {
+		writeNotFound(w, r)
+		return
+	}
+	delete(s.datasets, keyOf(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// touch gives ds a new ETag and modification time.
+func (s *Server) touch(ds *bqv2.Dataset) {
+	s.etagSeq++
+	ds.Etag = fmt.Sprintf("etag-%d", s.etagSeq)
+	ds.LastModifiedTime = time.Now().UnixMilli()
+}
+
+// applyPatch sets the fields present in the request on ds. Labels set to null
+// are removed, like in the real API.
+func applyPatch(ds *bqv2.Dataset, fields map[string]json.RawMessage) error {
+	for name, raw := range fields {
+		var err error
+		switch name {
+		case "friendlyName":
+			ds.FriendlyName, err = nullableString(raw)
+		case "description":
+			ds.Description, err = nullableString(raw)
+		case "access":
+			ds.Access = nil
+			err = json.Unmarshal(raw, &ds.Access)
+		case "labels":
+			var labels map[string]*string
+			if err = json.Unmarshal(raw, &labels); err != nil {
+				break
+			}
+			if ds.Labels == nil {
+				ds.Labels = map[string]string{}
+			}
+			for key, value := range labels {
+				if value == nil {
+					delete(ds.Labels, key)
+				} else {
+					ds.Labels[key] = *value
+				}
+			}
+		case "defaultTableExpirationMs":
+			var ms string
+			if err = json.Unmarshal(raw, &ms); err == nil && ms != "" {
+				ds.DefaultTableExpirationMs, err = strconv.ParseInt(ms, 10, 64)
+			}
+		case "datasetReference", "kind", "id", "etag":
+			// Read-only or identifying fields sent back by clients
+		default:
+			return fmt.Errorf("field %s is not supported by the fake", name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func nullableString(raw json.RawMessage) (string, error) {
+	var s *string
+	if err := json.Unmarshal(raw, &s); err != nil || s == nil {
+		return "", err
+	}
+	return *s, nil
+}
+
+var specialGroups = []string{"projectOwners", "projectReaders", "projectWriters", "allAuthenticatedUsers"}
+
+// validateAccess rejects access entries the real API would reject: entries
+// must grant a role to exactly one entity, except for views, routines and
+// datasets which are authorized without a role.
+func validateAccess(access []*bqv2.DatasetAccess) error {
+	for i, entry := range access {
+		var entities []string
+		add := func(name string, set bool) {
+			if set {
+				entities = append(entities, name)
+			}
+		}
+		add("userByEmail", entry.UserByEmail != "")
+		add("groupByEmail", entry.GroupByEmail != "")
+		add("domain", entry.Domain != "")
+		add("specialGroup", entry.SpecialGroup != "")
+		add("iamMember", entry.IamMember != "")
+		add("view", entry.View != nil)
+		add("routine", entry.Routine != nil)
+		add("dataset", entry.Dataset != nil)
+
+		if len(entities) != 1 {
+			return fmt.Errorf("access[%d]: exactly one entity must be set, got %v", i, entities)
+		}
+
+		switch entities[0] {
+		case "view", "routine", "dataset":
+			if entry.Role != "" {
+				return fmt.Errorf("access[%d]: role can't be set for %s access", i, entities[0])
+			}
+			continue
+		case "userByEmail":
+			if !strings.Contains(entry.UserByEmail, "@") {
+				return fmt.Errorf("access[%d]: invalid email address %q", i, entry.UserByEmail)
+			}
+		case "groupByEmail":
+			if !strings.Contains(entry.GroupByEmail, "@") {
+				return fmt.Errorf("access[%d]: invalid email address %q", i, entry.GroupByEmail)
+			}
+		case "specialGroup":
+			if !slices.Contains(specialGroups, entry.SpecialGroup) {
+				return fmt.Errorf("access[%d]: invalid special group %q", i, entry.SpecialGroup)
+			}
+		}
+
+		switch {
+		case entry.Role == "":
+			return fmt.Errorf("access[%d]: role is required", i)
+		case slices.Contains([]string{"READER", "WRITER", "OWNER"}, entry.Role), strings.HasPrefix(entry.Role, "roles/"):
+		default:
+			return fmt.Errorf("access[%d]: invalid role %q", i, entry.Role)
+		}
+	}
+	return nil
+}
+
+// filter is a parsed dataset list filter, which only supports labels, such as
+// "labels.team:a labels.env".
+type filter map[string]*string
+
+func parseFilter(s string) (filter, error) {
+	f := filter{}
+	for term := range strings.FieldsSeq(s) {
+		label, ok := strings.CutPrefix(term, "labels.")
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q: only labels are supported", s)
+		}
+		if key, value, ok := strings.Cut(label, ":"); ok {
+			f[key] = &value
+		} else {
+			f[label] = nil
+		}
+	}
+	return f, nil
+}
+
+func (f filter) matches(ds *bqv2.Dataset) bool {
+	for key, value := range f {
+		actual, ok := ds.Labels[key]
+		if !ok || (value != nil && actual != *value) {
+			return false
+		}
+	}
+	return true
+}
+
+func keyOf(r *http.Request) datasetKey {
+	return datasetKey{r.PathValue("project"), r.PathValue("dataset")}
+}
+
+func clone(ds *bqv2.Dataset) *bqv2.Dataset {
+	data, err := json.Marshal(ds)
+	if err != nil {
+		panic(err)
+	}
+	out := &bqv2.Dataset{}
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, fmt.Sprintf("Not found: Dataset %s:%s", r.PathValue("project"), r.PathValue("dataset")))
+}
+
+// errorReasons are the reasons the real API gives for each status code.
+var errorReasons = map[int]string{
+	http.StatusBadRequest:          "invalid",
+	http.StatusForbidden:           "accessDenied",
+	http.StatusNotFound:            "notFound",
+	http.StatusConflict:            "duplicate",
+	http.StatusPreconditionFailed:  "conditionNotMet",
+	http.StatusTooManyRequests:     "rateLimitExceeded",
+	http.StatusInternalServerError: "backendError",
+	http.StatusServiceUnavailable:  "backendError",
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	reason := errorReasons[code]
+	if reason == "" {
+		reason = "unknown"
+	}
+	writeJSON(w, code, map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"errors": []map[string]string{
+				{"reason": reason, "message": message, "domain": "global"},
+			},
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
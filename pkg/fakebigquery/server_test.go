@@ -0,0 +1,172 @@
+package fakebigquery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	bqv2 "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+func newClient(t *testing.T) (*Server, *bigquery.Client) {
+	server := New()
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := bigquery.NewClient(context.Background(), "proj",
+		option.WithEndpoint(srv.URL),
+		option.WithoutAuthentication(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func errorCode(err error) int {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code
+	}
+	return 0
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	server, client := newClient(t)
+	ds := client.Dataset("ds")
+
+	t.Run("get of missing dataset is 404", func(t *testing.T) {
+		if _, err := ds.Metadata(ctx); errorCode(err) != http.StatusNotFound {
+			t.Errorf("expected 404, got %v", err)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		err := ds.Create(ctx, &bigquery.DatasetMetadata{
+			Name:     "friendly",
+			Location: "europe-north1",
+			Labels:   map[string]string{"team": "a"},
+			Access: []*bigquery.AccessEntry{
+				{Role: bigquery.OwnerRole, EntityType: bigquery.UserEmailEntity, Entity: "owner@example.com"},
+				{EntityType: bigquery.ViewEntity, View: &bigquery.Table{ProjectID: "proj", DatasetID: "other", TableID: "view"}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md, err := ds.Metadata(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Name != "friendly" || md.Location != "europe-north1" || md.Labels["team"] != "a" || len(md.Access) != 2 || md.ETag == "" {
+			t.Errorf("unexpected metadata %+v", md)
+		}
+	})
+
+	t.Run("create of existing dataset is 409", func(t *testing.T) {
+		if err := ds.Create(ctx, &bigquery.DatasetMetadata{}); errorCode(err) != http.StatusConflict {
+			t.Errorf("expected 409, got %v", err)
+		}
+	})
+
+	t.Run("invalid access is rejected", func(t *testing.T) {
+		err := client.Dataset("invalid").Create(ctx, &bigquery.DatasetMetadata{
+			Access: []*bigquery.AccessEntry{{Role: bigquery.ReaderRole, EntityType: bigquery.UserEmailEntity, Entity: "not-an-email"}},
+		})
+		if errorCode(err) != http.StatusBadRequest {
+			t.Errorf("expected 400, got %v", err)
+		}
+	})
+
+	t.Run("update with current etag", func(t *testing.T) {
+		md, err := ds.Metadata(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update := bigquery.DatasetMetadataToUpdate{Description: "updated"}
+		update.SetLabel("app", "b")
+		update.DeleteLabel("team")
+		updated, err := ds.Update(ctx, update, md.ETag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Description != "updated" || updated.Labels["app"] != "b" || updated.Labels["team"] != "" || updated.Name != "friendly" {
+			t.Errorf("unexpected metadata after update %+v", updated)
+		}
+		if updated.ETag == md.ETag {
+			t.Error("expected etag to change")
+		}
+	})
+
+	t.Run("update with stale etag is 412", func(t *testing.T) {
+		md, err := ds.Metadata(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Modify("proj", "ds", func(d *bqv2.Dataset) { d.Description = "changed elsewhere" })
+
+		_, err = ds.Update(ctx, bigquery.DatasetMetadataToUpdate{Description: "mine"}, md.ETag)
+		if errorCode(err) != http.StatusPreconditionFailed {
+			t.Errorf("expected 412, got %v", err)
+		}
+	})
+
+	t.Run("injected faults", func(t *testing.T) {
+		server.InjectFault(Fault{Method: http.MethodGet, DatasetID: "ds", Code: http.StatusForbidden, Times: 1})
+
+		if _, err := ds.Metadata(ctx); errorCode(err) != http.StatusForbidden {
+			t.Errorf("expected injected 403, got %v", err)
+		}
+		if _, err := ds.Metadata(ctx); err != nil {
+			t.Errorf("expected fault to be used up, got %v", err)
+		}
+	})
+
+	t.Run("list with filter and pages", func(t *testing.T) {
+		for _, id := range []string{"a", "b", "c"} {
+			if err := client.Dataset(id).Create(ctx, &bigquery.DatasetMetadata{Labels: map[string]string{"team": "x"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		it := client.Datasets(ctx)
+		it.Filter = "labels.team:x"
+		it.PageInfo().MaxSize = 2
+		var ids []string
+		for {
+			d, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, d.DatasetID)
+		}
+		if len(ids) != 3 || ids[0] != "a" || ids[2] != "c" {
+			t.Errorf("unexpected datasets %v", ids)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := ds.Delete(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if server.HasDataset("proj", "ds") {
+			t.Error("expected dataset to be deleted")
+		}
+		if err := ds.Delete(ctx); errorCode(err) != http.StatusNotFound {
+			t.Errorf("expected 404, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var datasetsDesc = prometheus.NewDesc(
+	"bqrator_bigquerydatasets",
+	"number of bigquerydatasets by team and status of the Ready condition",
+	[]string{"team", "ready"}, nil,
+)
+
+// DatasetCollector counts BigQueryDatasets by team and Ready status when
+// scraped. It should be given a cached reader, so that scrapes don't reach the
+// API server. Nothing is reported while the cache can't be read, e.g. before
+// it has started.
+type DatasetCollector struct {
+	Reader client.Reader
+}
+
+var _ prometheus.Collector = &DatasetCollector{}
+
+func (c *DatasetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- datasetsDesc
+}
+
+func (c *DatasetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var datasets google_nais_io_v1.BigQueryDatasetList
+	if err := c.Reader.List(ctx, &datasets); err != nil {
+		return
+	}
+
+	type key struct {
+		team  string
+		ready metav1.ConditionStatus
+	}
+	counts := map[key]int{}
+	for _, dataset := range datasets.Items {
+		ready := metav1.ConditionUnknown
+		if condition := meta.FindStatusCondition(dataset.Status.Conditions, "Ready"); condition != nil {
+			ready = condition.Status
+		}
+		counts[key{team: dataset.Namespace, ready: ready}]++
+	}
+
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(datasetsDesc, prometheus.GaugeValue, float64(n), k.team, string(k.ready))
+	}
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	google_nais_io_v1 "github.com/nais/liberator/pkg/apis/google.nais.io/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDatasetCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := google_nais_io_v1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	dataset := func(namespace, name string, ready metav1.ConditionStatus) *google_nais_io_v1.BigQueryDataset {
+		d := &google_nais_io_v1.BigQueryDataset{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		if ready != "" {
+			d.Status.Conditions = []metav1.Condition{{Type: "Ready", Status: ready}}
+		}
+		return d
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		dataset("team-a", "one", metav1.ConditionTrue),
+		dataset("team-a", "two", metav1.ConditionTrue),
+		dataset("team-a", "three", metav1.ConditionFalse),
+		dataset("team-b", "one", ""),
+	).Build()
+
+	expected := `
+# HELP bqrator_bigquerydatasets number of bigquerydatasets by team and status of the Ready condition
+# TYPE bqrator_bigquerydatasets gauge
+bqrator_bigquerydatasets{ready="False",team="team-a"} 1
+bqrator_bigquerydatasets{ready="True",team="team-a"} 2
+bqrator_bigquerydatasets{ready="Unknown",team="team-b"} 1
+`
+	if err := testutil.CollectAndCompare(&DatasetCollector{Reader: c}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
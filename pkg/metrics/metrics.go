@@ -9,8 +9,99 @@ var BigQueryDatasetProcessed = prometheus.NewCounter(prometheus.CounterOpts{
 	Help: "number of bigquerydataset synchronized",
 })
 
+// BigQueryDatasetOutcomes counts the changes made in BigQuery, where outcome is
+// one of create, update, noop, delete or recreate, and team is the namespace
+// of the dataset.
+var BigQueryDatasetOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bqrator_bigquerydataset_outcome_count",
+	Help: "number of bigquerydatasets synchronized by outcome and team",
+}, []string{"outcome", "team"})
+
+var ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bqrator_reconcile_duration_seconds",
+	Help:    "time spent reconciling a bigquerydataset",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+}, []string{"team"})
+
+var BigQueryCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bqrator_bigquery_calls_count",
+	Help: "number of bigquery api calls",
+}, []string{"method"})
+
+var BigQueryCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bqrator_bigquery_call_duration_seconds",
+	Help:    "latency of bigquery api calls",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+}, []string{"method"})
+
+// BigQueryErrors counts failed BigQuery calls by method and HTTP status code
+// from the API, or "unknown" for errors without one.
+var BigQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bqrator_bigquery_errors_count",
+	Help: "number of failed bigquery api calls",
+}, []string{"method", "code"})
+
+var BigQueryDryRunCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bqrator_bigquery_dry_run_calls_count",
+	Help: "number of mutating bigquery calls skipped in dry-run mode",
+}, []string{"operation"})
+
+var BigQueryThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bqrator_bigquery_throttled_count",
+	Help: "number of bigquery calls delayed by the client side rate limit",
+}, []string{"operation"})
+
+var BigQueryRateLimitWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bqrator_bigquery_rate_limit_wait_seconds",
+	Help:    "time throttled bigquery calls waited for the client side rate limit",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+}, []string{"operation"})
+
+var BigQueryRateLimitWaiting = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "bqrator_bigquery_rate_limit_waiting",
+	Help: "number of bigquery calls currently waiting for the client side rate limit",
+})
+
+// RequeueDelay complements controller-runtime's workqueue metrics, such as
+// workqueue_depth, with the delays given by the controller's rate limiter.
+var RequeueDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "bqrator_requeue_delay_seconds",
+	Help:    "delay given to rate limited requeues of bigquerydatasets",
+	Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+})
+
+var ReadinessLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "bqrator_readiness_last_success_timestamp_seconds",
+	Help: "unix time of the last successful bigquery connectivity check",
+})
+
+// OrphanedDatasets counts datasets labelled with a team, but not managed by any
+// BigQueryDataset in the team's namespace, as of the latest orphan scan.
+var OrphanedDatasets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bqrator_orphaned_datasets",
+	Help: "number of datasets labelled with a team that no bigquerydataset manages",
+}, []string{"team", "project"})
+
+var OrphanScanLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "bqrator_orphan_scan_last_success_timestamp_seconds",
+	Help: "unix time of the last successful scan for orphaned datasets",
+})
+
 func Register(registry prometheus.Registerer) {
 	registry.MustRegister(
 		BigQueryDatasetProcessed,
+		BigQueryDatasetOutcomes,
+		ReconcileDuration,
+		BigQueryCalls,
+		BigQueryCallDuration,
+		BigQueryErrors,
+		BigQueryDryRunCalls,
+		BigQueryThrottled,
+		BigQueryRateLimitWait,
+		BigQueryRateLimitWaiting,
+		RequeueDelay,
+		ReadinessLastSuccess,
+		OrphanedDatasets,
+		OrphanScanLastSuccess,
 	)
 }